@@ -0,0 +1,19 @@
+package elcli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var conditionCmd = &cobra.Command{
+	Use:   "condition",
+	Short: "Validate and test twin query conditions, such as the deployment target condition",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(conditionCmd)
+
+	addHubFlags(conditionCmd.PersistentFlags(), "the name of the iot hub to fetch the devices from")
+}
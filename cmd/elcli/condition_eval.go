@@ -0,0 +1,119 @@
+package elcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/condition"
+)
+
+// twinFiles holds the paths of the twin JSON snapshots to evaluate the condition against.
+var twinFiles []string
+
+var conditionTestCmd = &cobra.Command{
+	Use:   "test [condition]",
+	Short: "Validate a condition and print the devices it matches",
+	Long: `Validates a twin query condition, the deployment target condition of the configuration by default, and evaluates
+it against device twins: the JSON snapshots given with --twin (a twin or a list of twins per file, as returned by the
+IoT Hub), or every device of the hub otherwise. The devices matching the condition are printed.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadOptionalConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		executeConditionTest(args)
+	},
+}
+
+func init() {
+	conditionCmd.AddCommand(conditionTestCmd)
+
+	conditionTestCmd.Flags().StringArrayVar(&twinFiles, "twin", nil, "twin JSON snapshot file to evaluate the condition against (can be repeated)")
+}
+
+// executeConditionTest validates the condition and prints the twins matching it.
+func executeConditionTest(args []string) {
+	cond := config.Deployment.TargetCondition
+	if len(args) > 0 {
+		cond = args[0]
+	}
+
+	if cond == "" {
+		errorf("error: a condition or deployment.target-condition is required\n")
+		os.Exit(1)
+	}
+
+	c, err := condition.Parse(cond)
+	if err != nil {
+		errorf("invalid condition: %v\n", err)
+		if syntaxErr, ok := err.(*condition.SyntaxError); ok {
+			errorf("  %s\n  %s^\n", cond, strings.Repeat(" ", syntaxErr.Pos))
+		}
+		os.Exit(1)
+	}
+
+	twins, err := conditionTwins()
+	if err != nil {
+		errorf("error reading twins: %v\n", err)
+		os.Exit(1)
+	}
+
+	matches := 0
+	for _, t := range twins {
+		if !c.Match(t) {
+			continue
+		}
+
+		matches++
+		fmt.Println(t["deviceId"])
+	}
+
+	fmt.Printf("%d of %d devices match %s\n", matches, len(twins), c)
+}
+
+// conditionTwins returns the twins to evaluate the condition against, decoded from their JSON documents: the twin
+// snapshots files when given, every device twin of the hub otherwise.
+func conditionTwins() ([]map[string]interface{}, error) {
+	if len(twinFiles) == 0 {
+		return hubTwins()
+	}
+
+	twins := []map[string]interface{}{}
+	for _, f := range twinFiles {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		list := []map[string]interface{}{}
+		if err := json.Unmarshal(b, &list); err != nil {
+			twin := map[string]interface{}{}
+			if err := json.Unmarshal(b, &twin); err != nil {
+				return nil, fmt.Errorf("%s: %v", f, err)
+			}
+			list = append(list, twin)
+		}
+
+		twins = append(twins, list...)
+	}
+
+	return twins, nil
+}
+
+// hubTwins returns the twins of every device of the hub, as the JSON documents returned by the hub.
+func hubTwins() ([]map[string]interface{}, error) {
+	twins, res, err := newHubClient().Devices.QueryTwinDocuments("SELECT * FROM devices")
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return twins, nil
+}
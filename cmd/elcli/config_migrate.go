@@ -0,0 +1,67 @@
+package elcli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rewrite the configuration file with the latest schema version",
+	Run: func(cmd *cobra.Command, args []string) {
+		executeConfigMigrate()
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configMigrateCmd)
+}
+
+// executeConfigMigrate migrates the configuration file to the latest schema version and rewrites it. The original file
+// is kept next to it with the version it was written with as suffix (e.g. edge-leap.yaml.v1.bak).
+func executeConfigMigrate() {
+	info, err := os.Stat(cfgFile)
+	if err != nil {
+		errorf("error reading configuration file: %v\n", err)
+		os.Exit(1)
+	}
+
+	b, err := os.ReadFile(cfgFile)
+	if err != nil {
+		errorf("error reading configuration file: %v\n", err)
+		os.Exit(1)
+	}
+
+	raw, version, err := configuration.Decode(b)
+	if err != nil {
+		errorf("error loading configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if version == configuration.CONFIG_VERSION {
+		fmt.Printf("configuration is already at version %d\n", version)
+		return
+	}
+
+	migrated, err := configuration.Encode(raw)
+	if err != nil {
+		errorf("error encoding configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", cfgFile, version)
+	if err := os.WriteFile(backup, b, info.Mode().Perm()); err != nil {
+		errorf("error writing configuration backup: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(cfgFile, migrated, info.Mode().Perm()); err != nil {
+		errorf("error writing configuration file: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("configuration migrated from version %d to %d, previous version saved to %s\n", version, configuration.CONFIG_VERSION, backup)
+}
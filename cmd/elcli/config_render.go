@@ -0,0 +1,43 @@
+package elcli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+var configRenderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Print the effective configuration, with the selected environment applied",
+	Run: func(cmd *cobra.Command, args []string) {
+		executeConfigRender()
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configRenderCmd)
+}
+
+// executeConfigRender prints the configuration the commands would use: migrated to the latest schema version, with the
+// environment selected with --environment merged onto the base configuration, the variables resolved and the ELCLI_
+// environment variables applied. Secret values are redacted.
+func executeConfigRender() {
+	if _, err := decodeConfig(); err != nil {
+		errorf("error loading configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	raw := config.Raw()
+	delete(raw, "environments")
+	redactor.RedactRaw(raw)
+
+	b, err := configuration.Encode(raw)
+	if err != nil {
+		errorf("error encoding configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Print(string(b))
+}
@@ -0,0 +1,47 @@
+package elcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+var schemaOutput string
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the configuration file",
+	Run: func(cmd *cobra.Command, args []string) {
+		executeConfigSchema()
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configSchemaCmd)
+
+	configSchemaCmd.Flags().StringVarP(&schemaOutput, "output", "o", "", "file to write the schema to instead of the standard output")
+}
+
+// executeConfigSchema prints the JSON Schema of the configuration file, which editors can use to validate and complete
+// configuration files.
+func executeConfigSchema() {
+	b, err := json.MarshalIndent(configuration.JSONSchema(), "", "  ")
+	if err != nil {
+		errorf("error generating schema: %v\n", err)
+		os.Exit(1)
+	}
+	b = append(b, '\n')
+
+	if schemaOutput == "" {
+		fmt.Print(string(b))
+		return
+	}
+
+	if err := os.WriteFile(schemaOutput, b, 0644); err != nil {
+		errorf("error writing schema: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,41 @@
+package elcli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the configuration file",
+	Run: func(cmd *cobra.Command, args []string) {
+		executeConfigValidate()
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+}
+
+// executeConfigValidate validates the configuration file and prints every invalid value with its location in the file.
+func executeConfigValidate() {
+	_, err := loadConfig()
+	if err == nil {
+		fmt.Printf("%s: configuration is valid\n", cfgFile)
+		return
+	}
+
+	errs, ok := err.(configuration.ValidationErrors)
+	if !ok {
+		errorf("%s: %v\n", cfgFile, err)
+		os.Exit(1)
+	}
+
+	for _, e := range errs {
+		fmt.Printf("%s:%s\n", cfgFile, e)
+	}
+	os.Exit(1)
+}
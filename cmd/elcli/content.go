@@ -0,0 +1,42 @@
+package elcli
+
+import (
+	"fmt"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+	"github.com/unbrikd/edge-leap/internal/utils"
+)
+
+// setDeploymentContent adds the modules and routes of the configuration to a deployment. The images map overrides the
+// image of modules by module name, e.g. with a freshly built or a pinned image.
+func setDeploymentContent(d *azure.Configuration, images map[string]string) error {
+	for _, m := range config.Modules {
+		env, err := utils.StringArraySplitToMap(m.Env, "=")
+		if err != nil {
+			return fmt.Errorf("failed to parse environment variables of module %s: %v", m.Name, err)
+		}
+
+		image := m.Image
+		if i, ok := images[m.Name]; ok {
+			image = i
+		}
+
+		d.SetContent(m.Name, image, m.CreateOptions, m.StartupOrder, env)
+	}
+
+	d.SetRoutes(config.Routes)
+	return nil
+}
+
+// moduleImages returns the images of the configuration modules by module name, with the overrides applied.
+func moduleImages(overrides map[string]string) map[string]string {
+	images := map[string]string{}
+	for _, m := range config.Modules {
+		images[m.Name] = m.Image
+		if i, ok := overrides[m.Name]; ok {
+			images[m.Name] = i
+		}
+	}
+
+	return images
+}
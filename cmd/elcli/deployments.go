@@ -0,0 +1,19 @@
+package elcli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var deploymentsCmd = &cobra.Command{
+	Use:   "deployments",
+	Short: "Inspect the deployments of the IoT Hub",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deploymentsCmd)
+
+	addHubFlags(deploymentsCmd.PersistentFlags(), "the name of the iot hub")
+}
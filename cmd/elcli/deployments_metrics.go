@@ -0,0 +1,106 @@
+package elcli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+var deploymentsMetricsCmd = &cobra.Command{
+	Use:   "metrics [id]",
+	Short: "Print the system and custom metrics of a deployment",
+	Long: `Prints the metrics of a deployment, the one of the configuration by default: the system metrics computed by the
+hub (e.g. targetedCount, appliedCount) and the custom metrics of the deployment.metrics section, with the number of
+devices they count.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadOptionalConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		executeDeploymentsMetrics(args)
+	},
+}
+
+func init() {
+	deploymentsCmd.AddCommand(deploymentsMetricsCmd)
+}
+
+// executeDeploymentsMetrics prints the metrics of a deployment.
+func executeDeploymentsMetrics(args []string) {
+	id := config.Deployment.Id
+	if len(args) > 0 {
+		id = args[0]
+	}
+
+	if id == "" {
+		errorf("error: a deployment id or deployment.id is required\n")
+		os.Exit(1)
+	}
+
+	d, res, err := newHubClient().Configurations.GetConfiguration(context.Background(), id)
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		errorf("error getting deployment '%s': %v\n", id, err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SYSTEM METRIC\tDEVICES")
+	printMetrics(w, d.SystemMetrics, false)
+	w.Flush()
+
+	fmt.Println()
+	if d.Metrics == nil || len(d.Metrics.Queries) == 0 {
+		fmt.Println("no custom metric, they are defined in the deployment.metrics section of the configuration")
+		return
+	}
+
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CUSTOM METRIC\tDEVICES\tQUERY")
+	printMetrics(w, d.Metrics, true)
+	w.Flush()
+}
+
+// printMetrics prints the results of metrics sorted by name, with their query when asked. Metrics whose result has not
+// been computed by the hub yet are printed with a dash.
+func printMetrics(w *tabwriter.Writer, m *azure.ConfigurationMetrics, queries bool) {
+	if m == nil {
+		return
+	}
+
+	names := map[string]bool{}
+	for n := range m.Results {
+		names[n] = true
+	}
+	for n := range m.Queries {
+		names[n] = true
+	}
+
+	sorted := []string{}
+	for n := range names {
+		sorted = append(sorted, n)
+	}
+	sort.Strings(sorted)
+
+	for _, n := range sorted {
+		count := "-"
+		if v, ok := m.Results[n]; ok {
+			count = fmt.Sprint(v)
+		}
+
+		if queries {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", n, count, m.Queries[n])
+		} else {
+			fmt.Fprintf(w, "%s\t%s\n", n, count)
+		}
+	}
+}
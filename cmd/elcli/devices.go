@@ -0,0 +1,19 @@
+package elcli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var devicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "Manage the devices of the IoT Hub",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(devicesCmd)
+
+	addHubFlags(devicesCmd.PersistentFlags(), "the name of the iot hub")
+}
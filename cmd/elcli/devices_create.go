@@ -0,0 +1,100 @@
+package elcli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+var (
+	// deviceEdge creates IoT Edge devices.
+	deviceEdge bool
+	// deviceKeys are the primary and secondary symmetric keys of the device, generated by the hub when empty.
+	devicePrimaryKey, deviceSecondaryKey string
+	// deviceThumbprints are the primary and secondary thumbprints of the self signed certificates of the device.
+	devicePrimaryThumbprint, deviceSecondaryThumbprint string
+	// deviceCA authenticates the device with a certificate signed by a certificate authority.
+	deviceCA bool
+	// printConnectionString prints the connection string of the device.
+	printConnectionString bool
+)
+
+var devicesCreateCmd = &cobra.Command{
+	Use:   "create <deviceId>",
+	Short: "Create a device identity",
+	Long: `Creates a device identity in the IoT Hub, an IoT Edge device unless --edge=false is given. The device authenticates
+with symmetric keys generated by the hub by default, with the thumbprints of its self signed certificates when
+--primary-thumbprint is given, or with a certificate signed by a certificate authority with --ca. The connection string
+of the device, to provision its runtime with, is printed with --connection-string.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadOptionalConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		executeDevicesCreate(args[0])
+	},
+}
+
+func init() {
+	devicesCmd.AddCommand(devicesCreateCmd)
+
+	devicesCreateCmd.Flags().BoolVar(&deviceEdge, "edge", true, "create an IoT Edge device")
+	devicesCreateCmd.Flags().StringVar(&devicePrimaryKey, "primary-key", "", "primary symmetric key of the device (generated by the hub if empty)")
+	devicesCreateCmd.Flags().StringVar(&deviceSecondaryKey, "secondary-key", "", "secondary symmetric key of the device (generated by the hub if empty)")
+	devicesCreateCmd.Flags().StringVar(&devicePrimaryThumbprint, "primary-thumbprint", "", "thumbprint of the primary self signed certificate of the device")
+	devicesCreateCmd.Flags().StringVar(&deviceSecondaryThumbprint, "secondary-thumbprint", "", "thumbprint of the secondary self signed certificate of the device")
+	devicesCreateCmd.Flags().BoolVar(&deviceCA, "ca", false, "authenticate the device with a certificate signed by a certificate authority")
+	devicesCreateCmd.Flags().BoolVar(&printConnectionString, "connection-string", false, "print the connection string of the device")
+
+	devicesCreateCmd.MarkFlagsMutuallyExclusive("primary-key", "primary-thumbprint", "ca")
+	devicesCreateCmd.MarkFlagsMutuallyExclusive("secondary-key", "secondary-thumbprint", "ca")
+}
+
+// executeDevicesCreate creates a device identity.
+func executeDevicesCreate(deviceId string) {
+	redactor.Add(devicePrimaryKey, deviceSecondaryKey)
+
+	d := azure.Device{
+		DeviceId:       deviceId,
+		Status:         "enabled",
+		Authentication: azure.DeviceAuthentication{Type: azure.AUTH_SAS},
+		Capabilities:   azure.DeviceCapabilities{IoTEdge: deviceEdge},
+	}
+
+	switch {
+	case deviceCA:
+		d.Authentication.Type = azure.AUTH_CERTIFICATE_AUTHORITY
+	case devicePrimaryThumbprint != "" || deviceSecondaryThumbprint != "":
+		d.Authentication.Type = azure.AUTH_SELF_SIGNED
+		d.Authentication.X509Thumbprint = &azure.X509Thumbprint{PrimaryThumbprint: devicePrimaryThumbprint, SecondaryThumbprint: deviceSecondaryThumbprint}
+	case devicePrimaryKey != "" || deviceSecondaryKey != "":
+		d.Authentication.SymmetricKey = &azure.SymmetricKey{PrimaryKey: devicePrimaryKey, SecondaryKey: deviceSecondaryKey}
+	}
+
+	created, res, err := newHubClient().Devices.CreateDevice(d)
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		errorf("error creating device '%s': %v\n", deviceId, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("device %s created (%s, %s)\n", created.DeviceId, deviceKind(created), created.Authentication.Type)
+	if printConnectionString {
+		fmt.Println(created.ConnectionString(hubHostName(config.Infra.Hub)))
+	}
+}
+
+// deviceKind returns the kind of a device identity, edge or device.
+func deviceKind(d *azure.Device) string {
+	if d.Capabilities.IoTEdge {
+		return "edge"
+	}
+
+	return "device"
+}
@@ -0,0 +1,59 @@
+package elcli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var devicesDeleteCmd = &cobra.Command{
+	Use:   "delete <deviceId>...",
+	Short: "Delete device identities",
+	Long: `Deletes device identities from the IoT Hub, along with their twins. The deletion is confirmed on the terminal, or
+with --force.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadOptionalConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		executeDevicesDelete(args)
+	},
+}
+
+func init() {
+	devicesCmd.AddCommand(devicesDeleteCmd)
+}
+
+// executeDevicesDelete deletes device identities once confirmed.
+func executeDevicesDelete(deviceIds []string) {
+	if !force {
+		if !isTerminal(os.Stdin) {
+			errorf("error: use --force to delete devices without confirmation\n")
+			os.Exit(1)
+		}
+
+		answer := newPrompter(os.Stdin, os.Stdout).ask(fmt.Sprintf("Delete %s from %s? (y/N)", strings.Join(deviceIds, ", "), config.Infra.Hub), "")
+		if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			errorf("aborted\n")
+			os.Exit(1)
+		}
+	}
+
+	c := newHubClient()
+	for _, id := range deviceIds {
+		res, err := c.Devices.DeleteDevice(id)
+		if err == nil {
+			err = res.Expect(http.StatusOK, http.StatusNoContent)
+		}
+		if err != nil {
+			errorf("error deleting device '%s': %v\n", id, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("device %s deleted\n", id)
+	}
+}
@@ -0,0 +1,76 @@
+package elcli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// DEFAULT_DEVICES_TOP is the maximum number of devices listed, the maximum allowed by the hub.
+const DEFAULT_DEVICES_TOP = 1000
+
+// devicesTop is the maximum number of devices listed.
+var devicesTop int
+
+var devicesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the device identities of the hub",
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadOptionalConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		executeDevicesList()
+	},
+}
+
+func init() {
+	devicesCmd.AddCommand(devicesListCmd)
+
+	devicesListCmd.Flags().IntVar(&devicesTop, "top", DEFAULT_DEVICES_TOP, "maximum number of devices to list")
+}
+
+// executeDevicesList prints the device identities of the hub.
+func executeDevicesList() {
+	devices, res, err := newHubClient().Devices.ListDevices(devicesTop)
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		errorf("error listing devices: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(devices) == 0 {
+		fmt.Println("no device")
+		return
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].DeviceId < devices[j].DeviceId
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEVICE\tKIND\tAUTH\tSTATUS\tCONNECTION\tLAST ACTIVITY")
+	for _, d := range devices {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", d.DeviceId, deviceKind(&d), d.Authentication.Type, d.Status, strings.ToLower(d.ConnectionState), activityTime(d.LastActivityTime))
+	}
+
+	w.Flush()
+}
+
+// activityTime returns a device activity time in the local time zone, a dash if the device has never been active.
+func activityTime(s string) string {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil || t.Year() <= 1 {
+		return "-"
+	}
+
+	return t.Local().Format(time.RFC3339)
+}
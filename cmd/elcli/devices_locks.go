@@ -0,0 +1,68 @@
+package elcli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+var devicesLocksCmd = &cobra.Command{
+	Use:   "locks",
+	Short: "List the devices locked by draft sessions",
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadOptionalConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		executeDevicesLocks()
+	},
+}
+
+func init() {
+	devicesCmd.AddCommand(devicesLocksCmd)
+}
+
+// executeDevicesLocks prints the leases of the devices of the hub, expired leases included.
+func executeDevicesLocks() {
+	c := newHubClient()
+
+	twins, res, err := c.Devices.QueryTwins(fmt.Sprintf("SELECT * FROM devices WHERE is_defined(tags.%s)", azure.LEASE_TAG))
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		errorf("error querying devices: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(twins) == 0 {
+		fmt.Println("no device is locked")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEVICE\tOWNER\tSESSION\tMODULE\tEXPIRES\tSTATUS")
+
+	now := time.Now()
+	for _, t := range twins {
+		l, err := t.Lease()
+		if err != nil || l == nil {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\tinvalid\n", t.DeviceId)
+			continue
+		}
+
+		status := "locked"
+		if l.Expired(now) {
+			status = "expired"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.DeviceId, l.Owner, l.Session, l.Module, l.ExpiresAt.Local().Format(time.RFC3339), status)
+	}
+
+	w.Flush()
+}
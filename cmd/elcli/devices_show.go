@@ -0,0 +1,60 @@
+package elcli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var devicesShowCmd = &cobra.Command{
+	Use:   "show <deviceId>",
+	Short: "Show a device identity",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadOptionalConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		executeDevicesShow(args[0])
+	},
+}
+
+func init() {
+	devicesCmd.AddCommand(devicesShowCmd)
+
+	devicesShowCmd.Flags().BoolVar(&printConnectionString, "connection-string", false, "print the connection string of the device")
+}
+
+// executeDevicesShow prints a device identity, and its connection string when asked.
+func executeDevicesShow(deviceId string) {
+	d, res, err := newHubClient().Devices.GetDevice(deviceId)
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		errorf("error getting device '%s': %v\n", deviceId, err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Device:\t%s\n", d.DeviceId)
+	fmt.Fprintf(w, "Kind:\t%s\n", deviceKind(d))
+	fmt.Fprintf(w, "Status:\t%s\n", d.Status)
+	fmt.Fprintf(w, "Connection:\t%s\n", strings.ToLower(d.ConnectionState))
+	fmt.Fprintf(w, "Last activity:\t%s\n", activityTime(d.LastActivityTime))
+	fmt.Fprintf(w, "Authentication:\t%s\n", d.Authentication.Type)
+	if t := d.Authentication.X509Thumbprint; t != nil && t.PrimaryThumbprint != "" {
+		fmt.Fprintf(w, "Primary thumbprint:\t%s\n", t.PrimaryThumbprint)
+		fmt.Fprintf(w, "Secondary thumbprint:\t%s\n", t.SecondaryThumbprint)
+	}
+
+	if printConnectionString {
+		fmt.Fprintf(w, "Connection string:\t%s\n", d.ConnectionString(hubHostName(config.Infra.Hub)))
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,102 @@
+package elcli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/azure"
+	"github.com/unbrikd/edge-leap/internal/condition"
+	"github.com/unbrikd/edge-leap/internal/releaser"
+)
+
+// DEFAULT_JOB_INTERVAL is the time between two polls of the status of a job.
+const DEFAULT_JOB_INTERVAL = 5 * time.Second
+
+var (
+	// tagWhere is the condition selecting the devices to tag.
+	tagWhere string
+	// jobInterval is the time between two polls of the status of the job.
+	jobInterval time.Duration
+)
+
+var devicesTagCmd = &cobra.Command{
+	Use:   "tag key=value...",
+	Short: "Tag the devices matching a condition",
+	Long: `Sets tags on the twins of every device matching a condition, e.g. to sort a fleet into rollout rings, with a job
+of the IoT Hub updating the twins in bulk. The condition uses the syntax of the target conditions. Tags are given as
+key=value pairs, nested tags with dotted keys (e.g. elcli.ring=canary), and values are read as JSON when valid, as
+strings otherwise. A tag set to null is removed. The progress of the job is printed until it is over.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadOptionalConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		executeDevicesTag(args)
+	},
+}
+
+func init() {
+	devicesCmd.AddCommand(devicesTagCmd)
+
+	devicesTagCmd.Flags().StringVar(&tagWhere, "where", "", "condition selecting the devices to tag, e.g. tags.environment='prod'")
+	devicesTagCmd.Flags().DurationVar(&jobInterval, "interval", DEFAULT_JOB_INTERVAL, "time between two polls of the job status")
+	devicesTagCmd.MarkFlagRequired("where")
+}
+
+// executeDevicesTag tags the devices matching the condition with a twin update job and reports its progress.
+func executeDevicesTag(pairs []string) {
+	if _, err := condition.Parse(tagWhere); err != nil {
+		errorf("invalid condition: %v\n", err)
+		if syntaxErr, ok := err.(*condition.SyntaxError); ok {
+			errorf("  %s\n  %s^\n", tagWhere, strings.Repeat(" ", syntaxErr.Pos))
+		}
+		os.Exit(1)
+	}
+
+	tags := map[string]interface{}{}
+	if err := setPairs(tags, pairs); err != nil {
+		errorf("error: %v\n", err)
+		os.Exit(1)
+	}
+
+	j := azure.NewTwinUpdateJob(fmt.Sprintf("elcli-tag-%d", time.Now().UnixNano()), tagWhere, tags)
+	fmt.Printf("tagging the devices matching %s with job %s\n", tagWhere, j.JobId)
+
+	last := ""
+	job, err := releaser.Azure(newHubClient()).RunJob(j, jobInterval, func(job *azure.Job) {
+		if p := jobProgress(job); p != last {
+			fmt.Println(p)
+			last = p
+		}
+	})
+	if err != nil {
+		errorf("error tagging the devices: %v\n", err)
+		os.Exit(1)
+	}
+
+	stats := job.DeviceJobStatistics
+	if stats == nil {
+		stats = &azure.JobDeviceStatistics{}
+	}
+
+	if stats.FailedCount > 0 {
+		errorf("error tagging the devices: %d of %d devices failed\n", stats.FailedCount, stats.DeviceCount)
+		os.Exit(1)
+	}
+
+	fmt.Printf("tagged %d devices\n", stats.SucceededCount)
+}
+
+// jobProgress returns the progress of a job, its status and its devices by status.
+func jobProgress(job *azure.Job) string {
+	stats := job.DeviceJobStatistics
+	if stats == nil {
+		return job.Status
+	}
+
+	return fmt.Sprintf("%s: %d/%d devices done, %d failed, %d pending", job.Status, stats.SucceededCount+stats.FailedCount, stats.DeviceCount, stats.FailedCount, stats.PendingCount+stats.RunningCount)
+}
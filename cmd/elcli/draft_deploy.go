@@ -1,26 +1,35 @@
 package elcli
 
 import (
+	"context"
 	"fmt"
-	"net/url"
+	"net/http"
 	"os"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"github.com/unbrikd/edge-leap/internal/azure"
+	"github.com/unbrikd/edge-leap/internal/builder"
+	"github.com/unbrikd/edge-leap/internal/configuration"
 	"github.com/unbrikd/edge-leap/internal/releaser"
-	"github.com/unbrikd/edge-leap/internal/utils"
 )
 
+var buildImage bool
+var skipImageCheck bool
+
 var draftDeployCmd = &cobra.Command{
 	Use:   "deploy",
 	Short: "Deploy a draft module",
 	Run: func(cmd *cobra.Command, args []string) {
 		if _, err := loadConfig(); err != nil {
-			fmt.Printf("error loading configuration: %v\n", err)
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		if err := applyModuleFlags(cmd.Flags()); err != nil {
+			errorf("error applying flags: %v\n", err)
 			os.Exit(1)
 		}
 		preExecuteChecksDraftDeploy()
+		checkLeaseDuration()
 		executeDraftDeploy()
 	},
 }
@@ -29,81 +38,187 @@ func init() {
 	draftCmd.AddCommand(draftDeployCmd)
 
 	// Deployment configuration
-	draftDeployCmd.Flags().StringVar(&config.Deployment.Id, "id", viper.GetString("deployment.id"), "id to use for deployment (must be kebab-case)")
-	viper.BindPFlag("deployment.id", draftDeployCmd.Flags().Lookup("id"))
+	draftDeployCmd.Flags().StringVar(&config.Deployment.Id, "id", "", "id to use for deployment (must be kebab-case)")
 
 	draftDeployCmd.Flags().Int16VarP(&config.Deployment.Priority, "priority", "p", 50, "module deployment priority")
-	viper.BindPFlag("deployment.priority", draftDeployCmd.Flags().Lookup("priority"))
 
-	draftDeployCmd.Flags().StringVarP(&config.Deployment.TargetCondition, "target-condition", "t", viper.GetString("deployment.target-condition"), "target condition for the deployment")
-	viper.BindPFlag("deployment.target-condition", draftDeployCmd.Flags().Lookup("target-condition"))
+	draftDeployCmd.Flags().StringVarP(&config.Deployment.TargetCondition, "target-condition", "t", "", "target condition for the deployment")
 
 	// Device configuration
-	draftDeployCmd.Flags().StringVar(&config.Device.Name, "device-name", viper.GetString("device.name"), "device name to deploy the module to")
-	viper.BindPFlag("device.name", draftDeployCmd.Flags().Lookup("device-name"))
-
-	// Module configuration
-	draftDeployCmd.Flags().StringVarP(&config.Module.Name, "module-name", "m", viper.GetString("module.name"), "desired module name to show in the iotedge list (must be camelCase)")
-	viper.BindPFlag("module.name", draftDeployCmd.Flags().Lookup("module-name"))
+	draftDeployCmd.Flags().StringVar(&config.Device.Name, "device-name", "", "device name to deploy the module to")
+	draftDeployCmd.Flags().StringVar(&config.Device.Strategy, "strategy", "", "how the draft is deployed to the device, deployment (default) or direct")
 
-	draftDeployCmd.Flags().StringVar(&config.Module.CreateOptions, "create-options", viper.GetString("module.create-options"), "runtime settings for the container of the module (json string)")
-	viper.BindPFlag("module.create-options", draftDeployCmd.Flags().Lookup("create-options"))
+	// Module configuration, applied to the main module
+	draftDeployCmd.Flags().StringVarP(&moduleFlags.Name, "module-name", "m", "", "desired module name to show in the iotedge list (must be camelCase)")
+	draftDeployCmd.Flags().StringVar(&moduleFlags.CreateOptions, "create-options", "", "runtime settings for the container of the module (json string)")
+	draftDeployCmd.Flags().IntVarP(&moduleFlags.StartupOrder, "startup-order", "s", 0, "module startup order")
+	draftDeployCmd.Flags().StringVarP(&moduleFlags.Image, "image", "i", "", "module image URL (must be a valid docker image URL)")
+	draftDeployCmd.Flags().StringArrayVarP(&moduleFlags.Env, "env", "e", nil, "environment variables for the module (key=value), overrides the env files and the configuration")
+	draftDeployCmd.Flags().StringArrayVar(&envFiles, "env-file", nil, "dotenv file to read the module environment variables from, overrides the configuration (can be repeated, later files win)")
 
-	draftDeployCmd.Flags().IntVarP(&config.Module.StartupOrder, "startup-order", "s", viper.GetInt("module.startup-order"), "module startup order")
-	viper.BindPFlag("module.startup-order", draftDeployCmd.Flags().Lookup("startup-order"))
+	// Build configuration
+	draftDeployCmd.Flags().BoolVar(&buildImage, "build", false, "build and push the module image before deploying it (requires the build section in the configuration)")
 
-	draftDeployCmd.Flags().StringVarP(&config.Module.Image, "image", "i", viper.GetString("module.image"), "module image URL (must be a valid docker image URL)")
-	viper.BindPFlag("module.image", draftDeployCmd.Flags().Lookup("image"))
+	draftDeployCmd.Flags().BoolVar(&skipImageCheck, "skip-image-check", false, "do not verify the image exists in the registry for the device platform before deploying")
+	draftDeployCmd.Flags().DurationVar(&leaseDuration, "lease-duration", DEFAULT_LEASE_DURATION, "time the device stays locked for the draft session (use --force to take over a device locked by another session)")
 
-	draftDeployCmd.Flags().StringSliceVarP(&config.Module.Env, "env", "e", nil, "environment variables for the module (key=value)")
-	viper.BindPFlag("module.env", draftDeployCmd.Flags().Lookup("env"))
-
-	// Infra configuration
-	draftDeployCmd.Flags().StringVar(&config.Infra.Hub, "hub", "", "the name of the iot hub to send the deployment to")
-	viper.BindPFlag("infra.hub", draftDeployCmd.Flags().Lookup("hub"))
-
-	// Auth configuration
-	draftDeployCmd.Flags().StringVar(&config.Auth.Token, "token", "", "token to authenticate the client")
-	viper.BindPFlag("auth.token", draftDeployCmd.Flags().Lookup("token"))
+	// Infra and auth configuration
+	addHubFlags(draftDeployCmd.Flags(), "the name of the iot hub to send the deployment to")
 }
 
 // preExecuteChecksDraftDeploy checks if the required flags are set before executing the draft deploy command
 func preExecuteChecksDraftDeploy() {
+	required := map[string]string{
+		"deployment.id": config.Deployment.Id,
+		"device.name":   config.Device.Name,
+		"module.name":   config.MainModule().Name,
+	}
+
 	for _, flag := range []string{"deployment.id", "device.name", "module.name"} {
-		if viper.GetString(flag) == "" {
-			fmt.Printf("error: %s is required\n", flag)
+		if required[flag] == "" {
+			errorf("error: %s is required\n", flag)
 			os.Exit(1)
 		}
 	}
 }
 
 func executeDraftDeploy() {
-	c := azure.NewClient(nil).WithAuthToken(config.Auth.Token)
-	c.BaseURL, _ = url.Parse(fmt.Sprintf("https://%s.azure-devices.net/", config.Infra.Hub))
-
-	moduleEnv, err := utils.StringArraySplitToMap(config.Module.Env, "=")
+	id, err := deployDraft(azure.DEFAULT_MODULE_VERSION)
 	if err != nil {
-		fmt.Println(err)
+		errorf("%v\n", err)
 		os.Exit(1)
 	}
 
-	r := releaser.AzureReleaser{Client: c}
-	if err := r.SetModuleOnDevice(config.Device.Name, config.Module.Name, config.Id); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	if id == "" {
+		fmt.Printf("applied %s to %s\n", config.MainModule().Name, config.Device.Name)
+		return
+	}
+
+	fmt.Println(id)
+}
+
+// deployDraft pushes the draft module of the current session to the configured device, along with the other modules
+// and the routes of the configuration. The device lease is acquired, or renewed, first. The module version of the main
+// module is set in the deployment manifest, changing it forces the edge runtime to recreate the module even if the
+// image reference did not change. The id of the draft deployment is returned, empty with the direct strategy which
+// applies the modules to the device without creating a deployment.
+func deployDraft(moduleVersion string) (string, error) {
+	c := newHubClient()
+	r := releaser.Azure(c)
+
+	// the device is locked before anything is built or deployed, so a draft of another session is never overwritten
+	if err := acquireDeviceLease(r); err != nil {
+		return "", err
+	}
+
+	main := config.MainModule()
+	overrides := map[string]string{}
+	if buildImage {
+		image, err := buildDraftImage(moduleVersion)
+		if err != nil {
+			return "", err
+		}
+		overrides[main.Name] = image
+	}
+
+	if !skipImageCheck {
+		platform, err := devicePlatform(c)
+		if err != nil {
+			return "", err
+		}
+
+		platforms := []string{}
+		if platform != "" {
+			platforms = append(platforms, platform)
+		}
+
+		for _, image := range moduleImages(overrides) {
+			if err := verifyImage(image, platforms); err != nil {
+				return "", fmt.Errorf("image check failed: %v", err)
+			}
+		}
 	}
 
 	d := azure.Configuration{
 		Id:              fmt.Sprintf("%s-%s", config.Deployment.Id, config.Id),
 		Priority:        config.Deployment.Priority,
-		TargetCondition: fmt.Sprintf("tags.application.%s='%s'", config.Module.Name, config.Id),
+		TargetCondition: fmt.Sprintf("tags.application.%s='%s'", main.Name, config.Id),
+	}
+	if err := setDeploymentContent(&d, overrides); err != nil {
+		return "", err
+	}
+	d.SetModuleVersion(main.Name, moduleVersion)
+
+	if config.Device.Strategy == configuration.STRATEGY_DIRECT {
+		return "", applyDraft(r, &d)
+	}
+
+	if err := r.SetModuleOnDevice(config.Device.Name, main.Name, config.Id); err != nil {
+		return "", err
 	}
-	d.SetContent(config.Module.Name, config.Module.Image, config.Module.CreateOptions, config.Module.StartupOrder, moduleEnv)
 
 	if err := r.ReleaseModule(&d); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return "", err
+	}
+
+	return d.Id, nil
+}
+
+// applyDraft applies the modules of the draft deployment to the deployment manifest of the device, without creating
+// the deployment. The module tag is still set on the device twin, so draft destroy knows which session the module
+// belongs to. The draft deployment of the session must not exist, the hub would override the applied manifest with it.
+func applyDraft(r *releaser.AzureReleaser, d *azure.Configuration) error {
+	_, res, err := r.Client.Configurations.GetConfiguration(context.Background(), d.Id)
+	if err == nil {
+		err = res.Expect(http.StatusOK, http.StatusNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("error getting deployment %s: %v", d.Id, err)
+	}
+
+	if res.Is(http.StatusOK) {
+		return fmt.Errorf("deployment %s of the session targets the device, remove it with elcli draft destroy before deploying with the %s strategy", d.Id, configuration.STRATEGY_DIRECT)
+	}
+
+	main := config.MainModule()
+	if err := r.SetModuleOnDevice(config.Device.Name, main.Name, config.Id); err != nil {
+		return err
+	}
+
+	return r.ApplyToDevice(config.Device.Name, d)
+}
+
+// buildDraftImage builds the main module image from the build section of the configuration and pushes it to the
+// registry of the module image, tagged with the rendered tag template. The returned image reference is pinned to the
+// pushed digest so the device runs exactly what was just built.
+func buildDraftImage(moduleVersion string) (string, error) {
+	main := config.MainModule()
+	if main.Image == "" {
+		return "", fmt.Errorf("the image of module %s is required to build the module image", main.Name)
+	}
+
+	tag, err := builder.RenderTag(config.Build.Tag, builder.TagData{Session: config.Id, Version: moduleVersion})
+	if err != nil {
+		return "", err
+	}
+
+	// build paths are relative to the project root, whatever the working directory
+	buildContext := config.Build.Context
+	if buildContext == "" {
+		buildContext = "."
+	}
+
+	repository := builder.Repository(main.Image)
+	b := builder.Docker(config.Build.Endpoint, config.Build.Builder)
+	digest, err := b.BuildAndPush(builder.BuildOptions{
+		Context:    projectPath(buildContext),
+		Dockerfile: projectPath(config.Build.Dockerfile),
+		Platforms:  config.Build.Platforms,
+		Image:      fmt.Sprintf("%s:%s", repository, tag),
+	})
+	if err != nil {
+		return "", err
 	}
 
-	fmt.Printf("%s-%s\n", config.Deployment.Id, config.Id)
+	return fmt.Sprintf("%s@%s", repository, digest), nil
 }
@@ -0,0 +1,83 @@
+package elcli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/configuration"
+	"github.com/unbrikd/edge-leap/internal/releaser"
+)
+
+var draftDestroyCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Remove the draft of the current session from the device and release the device",
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		preExecuteChecksDraftDeploy()
+		executeDraftDestroy()
+	},
+}
+
+func init() {
+	draftCmd.AddCommand(draftDestroyCmd)
+
+	draftDestroyCmd.Flags().StringVar(&config.Device.Name, "device-name", "", "device name the draft is deployed to")
+	draftDestroyCmd.Flags().StringVar(&config.Device.Strategy, "strategy", "", "how the draft was deployed to the device, deployment (default) or direct")
+	addHubFlags(draftDestroyCmd.Flags(), "the name of the iot hub the draft is deployed to")
+}
+
+// executeDraftDestroy deletes the draft deployment of the current session, removes the module tag from the device twin
+// if it still targets the session, along with the module from the device manifest with the direct strategy, and releases
+// the device lease. A lease held by another session is only released with --force.
+func executeDraftDestroy() {
+	c := newHubClient()
+	r := releaser.Azure(c)
+	main := config.MainModule()
+
+	id := fmt.Sprintf("%s-%s", config.Deployment.Id, config.Id)
+	if err := r.DeleteRelease(id); err != nil {
+		errorf("error deleting deployment %s: %v\n", id, err)
+		os.Exit(1)
+	}
+
+	twin, res, err := c.Devices.GetTwin(config.Device.Name)
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		errorf("error getting the device twin: %v\n", err)
+		os.Exit(1)
+	}
+
+	// another session may have deployed the module to the device since
+	if twin.Tag(fmt.Sprintf("application.%s", main.Name)) == config.Id {
+		if config.Device.Strategy == configuration.STRATEGY_DIRECT {
+			if err := r.RemoveModuleFromManifest(config.Device.Name, main.Name); err != nil {
+				errorf("error removing the module from the device manifest: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if err := r.RemoveModuleFromDevice(config.Device.Name, main.Name); err != nil {
+			errorf("error removing the module from the device: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	err = r.ReleaseLease(config.Device.Name, config.Id, force)
+	if _, ok := err.(*releaser.LeaseHeldError); ok {
+		errorf("error releasing the device: %v, use --force to release it\n", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		errorf("error releasing the device: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("destroyed %s and released %s\n", id, config.Device.Name)
+}
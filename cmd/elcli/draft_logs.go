@@ -0,0 +1,30 @@
+package elcli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var draftLogsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Print the logs of the module of the current session on the device",
+	Long: `Prints the logs of the main module of the current session on the device, like elcli modules logs, fetched through
+the GetModuleLogs method of the edge agent.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		preExecuteChecksDraftModule()
+		executeLogs(config.MainModule().Name)
+	},
+}
+
+func init() {
+	draftCmd.AddCommand(draftLogsCmd)
+
+	draftLogsCmd.Flags().StringVar(&config.Device.Name, "device-name", "", "device name the draft is deployed to")
+	addHubFlags(draftLogsCmd.Flags(), "the name of the iot hub the draft is deployed to")
+	addLogsFlags(draftLogsCmd)
+}
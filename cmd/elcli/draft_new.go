@@ -1,62 +1,479 @@
 package elcli
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/unbrikd/edge-leap/internal/configuration"
+	"github.com/unbrikd/edge-leap/internal/utils"
 )
 
+// templateName is the name or path of the template the configuration file is created from.
+var templateName string
+
+// nonInteractive disables the prompts of draft new, the values are taken from the template, the ELCLI_ environment
+// variables and the user configuration.
+var nonInteractive bool
+
+// rotate regenerates the session id of the existing configuration file, leaving the rest of the file untouched.
+var rotate bool
+
+// createOptionsPresets holds the create options offered by the draft new wizard, by preset name.
+var createOptionsPresets = map[string]string{
+	"none":         "",
+	"privileged":   `{"HostConfig":{"Privileged":true}}`,
+	"host-network": `{"HostConfig":{"NetworkMode":"host"}}`,
+}
+
 var newDraftCmd = &cobra.Command{
 	Use:   "new",
 	Short: "Sets a new module draft configuration",
+	Long: `Sets a new module draft configuration by creating the configuration file from a template.
+
+The hub, device, module name, image, create options and environment variables are prompted for, with defaults taken
+from the ELCLI_ environment variables, the template and the user configuration. Without a terminal, or with
+--non-interactive, the defaults are used and every required value must be provided by them.
+
+With --rotate, only the session id of the existing configuration file is regenerated: the other settings, comments and
+key ordering are preserved, and the former session id is recorded in previous-sessions.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		preExecuteChecksNewDraft()
-		if _, err := loadConfig(); err != nil {
-			fmt.Printf("error loading configuration: %v\n", err)
-			os.Exit(1)
+		if rotate {
+			executeRotateDraft()
+			return
 		}
 
+		preExecuteChecksNewDraft()
 		executeNewDraft()
 	},
 }
 
 func init() {
 	draftCmd.AddCommand(newDraftCmd)
+
+	newDraftCmd.Flags().StringVar(&templateName, "template", configuration.DEFAULT_TEMPLATE, fmt.Sprintf("name or path of the template to start from (available: %s)", strings.Join(configuration.TemplateNames(), ", ")))
+	newDraftCmd.Flags().BoolVar(&rotate, "rotate", false, "start a new session in the existing configuration file, keeping its settings")
+	newDraftCmd.Flags().BoolVar(&nonInteractive, "non-interactive", false, "do not prompt, take the values from the template, the environment and the user configuration")
 }
 
 // preExecuteChecksNewDraft checks if the configuration file exists and if the --force flag is set.
-// If the configuration file exists and the --force flag is not set, the function will exit with an error message
-// If the configuration file exists and the --force flag is set, the function will remove the configuration file and create a new one
+// If the configuration file exists and the --force flag is not set, the function will exit with an error message.
+// If the configuration file exists and the --force flag is set, it is overwritten once the new configuration is complete.
 func preExecuteChecksNewDraft() {
-	if _, err := os.Stat(cfgFile); err == nil {
-		if !force {
-			fmt.Printf("configuration file already exists, use --force to overwrite\n")
-			os.Exit(1)
+	if _, err := os.Stat(cfgFile); err == nil && !force {
+		errorf("configuration file already exists, use --force to overwrite\n")
+		os.Exit(1)
+	}
+}
+
+// executeRotateDraft starts a new draft session in the existing configuration file by regenerating its session id.
+func executeRotateDraft() {
+	b, err := os.ReadFile(cfgFile)
+	if err != nil {
+		errorf("error reading configuration file: %v\n", err)
+		os.Exit(1)
+	}
+
+	info, err := os.Stat(cfgFile)
+	if err != nil {
+		errorf("error reading configuration file: %v\n", err)
+		os.Exit(1)
+	}
+
+	id := newSessionId()
+	rotated, previous, err := configuration.RotateSession(b, id)
+	if err != nil {
+		errorf("error rotating session: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(cfgFile, rotated, info.Mode().Perm()); err != nil {
+		errorf("error writing configuration file: %v\n", err)
+		os.Exit(1)
+	}
+
+	if previous != "" {
+		fmt.Printf("session %s recorded in previous-sessions\n", previous)
+	}
+	fmt.Println(id)
+}
+
+// newSessionId returns a new random session id.
+func newSessionId() string {
+	return strings.Split(uuid.New().String(), "-")[4]
+}
+
+// draftAnswers holds the values of a new draft configuration, prompted for by the wizard.
+type draftAnswers struct {
+	Hub           string
+	Device        string
+	Module        string
+	Image         string
+	CreateOptions string
+	Env           []string
+	DeploymentId  string
+}
+
+// executeNewDraft generates a new draft session by creating a new configuration file to be used to deploy the draft module.
+// The values of the template are kept, except the session and the prompted values. Only the values of the template,
+// the user configuration and the environment variables used as answers are written, secrets stay out of the file.
+func executeNewDraft() {
+	raw, answers, err := newDraftDefaults()
+	if err != nil {
+		errorf("error reading template: %v\n", err)
+		os.Exit(1)
+	}
+
+	id := newSessionId()
+	raw["session"] = id
+	raw["version"] = configuration.CONFIG_VERSION
+
+	interactive := !nonInteractive && isTerminal(os.Stdin)
+	p := newPrompter(os.Stdin, os.Stdout)
+	for {
+		if interactive {
+			askDraftAnswers(p, answers)
+		}
+
+		setDraftAnswers(raw, answers)
+		err := checkNewDraft(raw)
+		if err == nil {
+			break
 		}
 
-		if err := os.Remove(cfgFile); err != nil {
-			fmt.Printf("error deleting existing configuration file: %v\n", err)
+		// answers cannot be corrected once the input is closed
+		if !interactive || p.eof {
+			errorf("error creating configuration: %v\n", err)
 			os.Exit(1)
 		}
+		errorf("%v\n\nplease correct the values\n", err)
 	}
 
-	if _, err := os.Create(cfgFile); err != nil {
-		fmt.Printf("error creating new configuration file: %v\n", err)
+	b, err := configuration.Encode(raw)
+	if err != nil {
+		errorf("error encoding configuration: %v\n", err)
 		os.Exit(1)
 	}
-}
 
-// executeNewDraft generates a new draft session by creating a new configuration file to be used to deploy the draft module
-func executeNewDraft() {
-	id := strings.Split(uuid.New().String(), "-")[4]
-	viper.Set("session", id)
-	viper.Set("version", configuration.CONFIG_VERSION)
-	viper.WriteConfig()
+	header := fmt.Sprintf("# yaml-language-server: $schema=%s\n", configuration.JSON_SCHEMA_ID)
+	if err := os.WriteFile(cfgFile, append([]byte(header), b...), 0644); err != nil {
+		errorf("error writing configuration file: %v\n", err)
+		os.Exit(1)
+	}
 
 	fmt.Println(id)
 }
+
+// newDraftDefaults reads the template and returns it along with the default answers. Defaults are taken, by order of
+// precedence, from the ELCLI_ environment variables, the template and the user configuration. The module name defaults
+// to the name of the working directory in camelCase, and the deployment id to the module name in kebab-case.
+func newDraftDefaults() (map[string]interface{}, *draftAnswers, error) {
+	b, err := configuration.Template(templateName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, _, err := configuration.Decode(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	configuration.Normalize(raw)
+
+	user, err := readUserConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value := func(key string, path ...string) string {
+		if v, ok := os.LookupEnv(configuration.EnvVar(key)); ok {
+			return v
+		}
+
+		if v := rawString(raw, path...); v != "" {
+			return v
+		}
+
+		return rawString(user, path...)
+	}
+
+	a := &draftAnswers{
+		Hub:           value("infra.hub", "infra", "hub"),
+		Device:        value("device.name", "device", "name"),
+		Module:        value("module.name", "modules", "name"),
+		Image:         value("module.image", "modules", "image"),
+		CreateOptions: value("module.create-options", "modules", "create-options"),
+		DeploymentId:  value("deployment.id", "deployment", "id"),
+	}
+
+	if m := mainRawModule(raw); m != nil {
+		for _, e := range asList(m["env"]) {
+			a.Env = append(a.Env, fmt.Sprint(e))
+		}
+	}
+
+	if a.Module == "" {
+		if wd, err := os.Getwd(); err == nil {
+			a.Module = camelCase(filepath.Base(wd))
+		}
+	}
+
+	return raw, a, nil
+}
+
+// askDraftAnswers prompts for the values of a new draft configuration, the current answers being the defaults.
+func askDraftAnswers(p *prompter, a *draftAnswers) {
+	a.Hub = p.ask("IoT Hub name", a.Hub)
+	a.Device = p.ask("Device name", a.Device)
+
+	// the deployment id follows the module name, unless it has been set
+	derived := a.DeploymentId == "" || a.DeploymentId == kebabCase(a.Module)
+	a.Module = p.ask("Module name (camelCase)", a.Module)
+	if derived {
+		a.DeploymentId = kebabCase(a.Module)
+	}
+
+	a.Image = p.ask("Module image", a.Image)
+	a.DeploymentId = p.ask("Deployment id (kebab-case)", a.DeploymentId)
+
+	presets := []string{}
+	for name := range createOptionsPresets {
+		presets = append(presets, name)
+	}
+	sort.Strings(presets)
+
+	opts := p.ask(fmt.Sprintf("Create options (%s or a JSON object)", strings.Join(presets, ", ")), a.CreateOptions)
+	if preset, ok := createOptionsPresets[opts]; ok {
+		opts = preset
+	}
+	a.CreateOptions = opts
+
+	if len(a.Env) > 0 {
+		fmt.Printf("Environment variables: %s\n", strings.Join(a.Env, ", "))
+	}
+	a.Env = editEnv(a.Env, p.askList("Add an environment variable (KEY=VALUE, -KEY to remove, empty to finish)"))
+}
+
+// editEnv applies the answers to the environment variables: KEY=VALUE adds or replaces the variable, -KEY removes it so
+// an invalid variable can be corrected.
+func editEnv(env []string, answers []string) []string {
+	for _, answer := range answers {
+		key, ok := strings.CutPrefix(answer, "-")
+		if !ok {
+			env = utils.MergeKeyValuePairs("=", env, []string{answer})
+			continue
+		}
+
+		kept := []string{}
+		for _, e := range env {
+			if k, _, _ := strings.Cut(e, "="); k != key {
+				kept = append(kept, e)
+			}
+		}
+		env = kept
+	}
+
+	return env
+}
+
+// setDraftAnswers sets the answers in the raw configuration, the answers apply to the main module.
+func setDraftAnswers(raw map[string]interface{}, a *draftAnswers) {
+	if a.DeploymentId == "" {
+		a.DeploymentId = kebabCase(a.Module)
+	}
+
+	setRawString(raw, a.Hub, "infra", "hub")
+	setRawString(raw, a.Device, "device", "name")
+	setRawString(raw, a.DeploymentId, "deployment", "id")
+
+	m := mainRawModule(raw)
+	if m == nil {
+		m = map[string]interface{}{}
+		raw["modules"] = append([]interface{}{m}, asList(raw["modules"])...)
+	}
+
+	setRawString(m, a.Module, "name")
+	setRawString(m, a.Image, "image")
+	setRawString(m, a.CreateOptions, "create-options")
+
+	delete(m, "env")
+	if len(a.Env) > 0 {
+		env := []interface{}{}
+		for _, e := range a.Env {
+			env = append(env, e)
+		}
+		m["env"] = env
+	}
+}
+
+// setRawString sets a string value at the path of a raw configuration, creating the missing mappings. The value is
+// removed when empty.
+func setRawString(raw map[string]interface{}, v string, path ...string) {
+	m := raw
+	for _, k := range path[:len(path)-1] {
+		child, ok := m[k].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			m[k] = child
+		}
+		m = child
+	}
+
+	key := path[len(path)-1]
+	if v == "" {
+		delete(m, key)
+		return
+	}
+
+	m[key] = v
+}
+
+// checkNewDraft checks the new draft configuration holds every value required to deploy the draft and is valid.
+// Values holding variables that cannot be resolved yet are not validated.
+func checkNewDraft(raw map[string]interface{}) error {
+	missing := []string{}
+	for _, path := range [][]string{{"infra", "hub"}, {"device", "name"}, {"modules", "name"}, {"modules", "image"}, {"deployment", "id"}} {
+		if rawString(raw, path...) == "" {
+			missing = append(missing, strings.Replace(strings.Join(path, "."), "modules", "modules[0]", 1))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing values: %s (set them in the template, the user configuration or through the ELCLI_ environment variables)", strings.Join(missing, ", "))
+	}
+
+	b, err := configuration.Encode(raw)
+	if err != nil {
+		return err
+	}
+
+	resolved, _, err := configuration.Decode(b)
+	if err != nil {
+		return err
+	}
+
+	unresolved := map[string]bool{}
+	for _, path := range configuration.ResolveKnown(resolved) {
+		unresolved[path] = true
+	}
+
+	// the metrics are validated by name
+	deployment, _ := resolved["deployment"].(map[string]interface{})
+	for i, m := range asList(deployment["metrics"]) {
+		if metric, ok := m.(map[string]interface{}); ok && unresolved[fmt.Sprintf("deployment.metrics[%d].query", i)] {
+			unresolved[fmt.Sprintf("deployment.metrics.%v", metric["name"])] = true
+		}
+	}
+
+	if b, err = configuration.Encode(resolved); err != nil {
+		return err
+	}
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(b)); err != nil {
+		return err
+	}
+
+	c := configuration.Configuration{}
+	if err := v.Unmarshal(&c); err != nil {
+		return err
+	}
+
+	var errs configuration.ValidationErrors
+	if err := c.Validate(); !errors.As(err, &errs) {
+		return err
+	}
+
+	known := configuration.ValidationErrors{}
+	for _, e := range errs {
+		if !unresolved[e.Path] {
+			known = append(known, e)
+		}
+	}
+
+	if len(known) == 0 {
+		return nil
+	}
+
+	return known
+}
+
+// mainRawModule returns the main module of a raw configuration, nil if it has none.
+func mainRawModule(raw map[string]interface{}) map[string]interface{} {
+	modules := asList(raw["modules"])
+	if len(modules) == 0 {
+		return nil
+	}
+
+	m, _ := modules[0].(map[string]interface{})
+	return m
+}
+
+// rawString returns the string value found at the path of a raw configuration, the main module standing for the
+// modules list. An empty string is returned if there is none.
+func rawString(raw map[string]interface{}, path ...string) string {
+	var v interface{} = raw
+	for _, k := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+
+		if v = m[k]; k == "modules" {
+			v = mainRawModule(m)
+		}
+	}
+
+	if v == nil {
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
+
+// asList returns the value as a list, nil if it is not a list.
+func asList(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+// camelCase converts a name such as a directory name (e.g. my-module) to camelCase (e.g. myModule).
+func camelCase(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+
+	var b strings.Builder
+	for i, w := range words {
+		r, size := utf8.DecodeRuneInString(w)
+		if i == 0 {
+			r = unicode.ToLower(r)
+		} else {
+			r = unicode.ToUpper(r)
+		}
+		b.WriteRune(r)
+		b.WriteString(w[size:])
+	}
+
+	return strings.TrimLeftFunc(b.String(), unicode.IsDigit)
+}
+
+// kebabCase converts a camelCase name (e.g. myModule) to kebab-case (e.g. my-module).
+func kebabCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteRune('-')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
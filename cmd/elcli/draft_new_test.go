@@ -0,0 +1,28 @@
+package elcli
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAskDraftAnswersCorrectsEnv(t *testing.T) {
+	a := &draftAnswers{
+		Hub:          "hub",
+		Device:       "device",
+		Module:       "myModule",
+		Image:        "image:1",
+		DeploymentId: "my-module",
+		Env:          []string{"1BAD=x", "KEEP=1"},
+	}
+
+	// the first answers keep the defaults, then the invalid variable is removed and a valid one added
+	input := strings.Repeat("\n", 6) + "-1BAD\nGOOD=x\nKEEP=2\n\n"
+	askDraftAnswers(newPrompter(strings.NewReader(input), io.Discard), a)
+
+	expected := []string{"KEEP=2", "GOOD=x"}
+	if !reflect.DeepEqual(a.Env, expected) {
+		t.Errorf("expected %v, got %v", expected, a.Env)
+	}
+}
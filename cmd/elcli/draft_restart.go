@@ -0,0 +1,68 @@
+package elcli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var draftRestartCmd = &cobra.Command{
+	Use:   "restart",
+	Short: "Restart the module of the current session on the device",
+	Long: `Restarts the main module of the current session on the device through the RestartModule method of the edge agent,
+without redeploying it. The device must be online.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		preExecuteChecksDraftModule()
+		executeDraftRestart()
+	},
+}
+
+func init() {
+	draftCmd.AddCommand(draftRestartCmd)
+
+	draftRestartCmd.Flags().StringVar(&config.Device.Name, "device-name", "", "device name the draft is deployed to")
+	addHubFlags(draftRestartCmd.Flags(), "the name of the iot hub the draft is deployed to")
+}
+
+// preExecuteChecksDraftModule checks the device and the main module are set before executing a draft command acting on
+// the module running on the device. Unlike a deployment, it does not need the deployment id.
+func preExecuteChecksDraftModule() {
+	required := map[string]string{
+		"device.name": config.Device.Name,
+		"module.name": config.MainModule().Name,
+	}
+
+	for _, flag := range []string{"device.name", "module.name"} {
+		if required[flag] == "" {
+			errorf("error: %s is required\n", flag)
+			os.Exit(1)
+		}
+	}
+}
+
+// executeDraftRestart restarts the main module on the device of the session.
+func executeDraftRestart() {
+	main := config.MainModule()
+
+	result, res, err := newHubClient().Devices.RestartModule(config.Device.Name, main.Name, DEFAULT_METHOD_RESPONSE_TIMEOUT)
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		errorf("error restarting module '%s': %v\n", main.Name, err)
+		os.Exit(1)
+	}
+
+	if result.Status < 200 || result.Status > 299 {
+		errorf("error restarting module '%s': the edge agent answered %d %s\n", main.Name, result.Status, string(result.Payload))
+		os.Exit(1)
+	}
+
+	fmt.Printf("restarted %s on %s\n", main.Name, config.Device.Name)
+}
@@ -0,0 +1,398 @@
+package elcli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/releaser"
+)
+
+// DEFAULT_IMAGE_INTERVAL is the time between two checks of the draft image in its registry.
+const DEFAULT_IMAGE_INTERVAL = 30 * time.Second
+
+var watchPaths []string
+var watchDebounce time.Duration
+var imageInterval time.Duration
+
+var draftWatchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Redeploy the draft module whenever the configuration file, the watched paths or the image change",
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		preExecuteChecksDraftDeploy()
+		checkLeaseDuration()
+		executeDraftWatch()
+	},
+}
+
+func init() {
+	draftCmd.AddCommand(draftWatchCmd)
+
+	draftWatchCmd.Flags().StringSliceVarP(&watchPaths, "path", "w", nil, "additional files or directories to watch for changes (directories are watched recursively)")
+	draftWatchCmd.Flags().DurationVar(&watchDebounce, "debounce", 2*time.Second, "time to wait for changes to settle before redeploying")
+	draftWatchCmd.Flags().DurationVar(&imageInterval, "image-interval", DEFAULT_IMAGE_INTERVAL, "time between two checks of the image in its registry, a new image pushed under the same reference triggering a redeployment (0 to disable)")
+	draftWatchCmd.Flags().BoolVar(&buildImage, "build", false, "build and push the module image before every deployment (requires the build section in the configuration)")
+	draftWatchCmd.Flags().BoolVar(&skipImageCheck, "skip-image-check", false, "do not verify the image exists in the registry for the device platform before deploying")
+	draftWatchCmd.Flags().StringVar(&config.Device.Strategy, "strategy", "", "how the draft is deployed to the device, deployment (default) or direct")
+	draftWatchCmd.Flags().DurationVar(&leaseDuration, "lease-duration", DEFAULT_LEASE_DURATION, "time the device stays locked for the draft session, the lease is renewed while watching")
+}
+
+// executeDraftWatch deploys the draft once and then redeploys it every time the configuration file or one of the watched
+// paths change, or a new image is pushed under the image reference of the module. Changes are debounced so that a burst
+// of writes (e.g. an editor saving several files) results in a single deployment. The device lease is renewed
+// periodically. The command runs until interrupted, or until the lease is taken over by another session.
+func executeDraftWatch() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		errorf("error creating file watcher: %v\n", err)
+		os.Exit(1)
+	}
+	defer watcher.Close()
+
+	w := draftWatcher{watcher: watcher, files: map[string]bool{}}
+	if err := w.addFile(cfgFile); err != nil {
+		errorf("error watching configuration file: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, p := range watchPaths {
+		if err := w.addPath(p); err != nil {
+			errorf("error watching %s: %v\n", p, err)
+			os.Exit(1)
+		}
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	// the lease is renewed well before it expires, so a failed renewal can be retried
+	renew := time.NewTicker(leaseDuration / 3)
+	defer renew.Stop()
+
+	images := &imageWatcher{}
+	l := draftWatchLoop{
+		debounce: watchDebounce,
+		changes:  w.changes(),
+		renew:    renew.C,
+		stop:     interrupt,
+		deploy: func(reload bool) {
+			redeployDraft(reload)
+			// the image deployed becomes the reference, so an image pushed by --build does not trigger a redeployment
+			if imageInterval > 0 {
+				images.changed()
+			}
+		},
+		imageChanged: images.changed,
+		renewLease:   renewDraftLease,
+	}
+
+	if imageInterval > 0 {
+		poll := time.NewTicker(imageInterval)
+		defer poll.Stop()
+		l.poll = poll.C
+	}
+
+	watchLog("watching %s for changes, press Ctrl+C to stop", strings.Join(append([]string{cfgFile}, watchPaths...), ", "))
+	l.run()
+}
+
+// draftWatchLoop redeploys the draft when its triggers fire. The actions are functions, so the loop runs without a hub.
+type draftWatchLoop struct {
+	// debounce is the time the changes must settle before redeploying
+	debounce time.Duration
+	// changes receives the file changes, true for a change of the configuration file
+	changes <-chan bool
+	// poll ticks when the image must be checked, nil if it is not watched
+	poll <-chan time.Time
+	// renew ticks when the lease must be renewed
+	renew <-chan time.Time
+	// stop receives when the watch must stop
+	stop <-chan os.Signal
+
+	// deploy redeploys the draft, reading the configuration file again if reload is true
+	deploy func(reload bool)
+	// imageChanged reports whether a new image was pushed under the image reference of the module
+	imageChanged func() bool
+	// renewLease renews the lease of the device, false if the lease was lost
+	renewLease func() bool
+}
+
+// run deploys the draft and then redeploys it on every change, until stopped or until the lease is lost.
+func (l *draftWatchLoop) run() {
+	l.deploy(false)
+
+	// the timer is created stopped and only armed when a relevant change is detected
+	debounce := time.NewTimer(l.debounce)
+	debounce.Stop()
+	configChanged := false
+
+	for {
+		select {
+		case isConfig, ok := <-l.changes:
+			if !ok {
+				return
+			}
+
+			configChanged = configChanged || isConfig
+			debounce.Reset(l.debounce)
+		case <-l.poll:
+			if l.imageChanged() {
+				watchLog("new image pushed for %s", config.MainModule().Image)
+				debounce.Reset(l.debounce)
+			}
+		case <-debounce.C:
+			l.deploy(configChanged)
+			configChanged = false
+		case <-l.renew:
+			if !l.renewLease() {
+				return
+			}
+		case <-l.stop:
+			watchLog("stopped watching")
+			return
+		}
+	}
+}
+
+// redeployDraft deploys the draft module with a new module version, so the edge runtime recreates the module even if
+// the image reference is the same. If reload is true the configuration file is read again before deploying. Errors are
+// reported but never stop the watch loop.
+func redeployDraft(reload bool) {
+	if reload {
+		if _, err := loadConfig(); err != nil {
+			watchLog("error loading configuration: %v", err)
+			return
+		}
+	}
+
+	moduleVersion := time.Now().UTC().Format("20060102.150405")
+	watchLog("deploying %s with version %s", config.MainModule().Name, moduleVersion)
+
+	id, err := deployDraft(moduleVersion)
+	if err != nil {
+		watchLog("deployment failed: %v", err)
+		return
+	}
+
+	if id == "" {
+		watchLog("applied %s to %s", config.MainModule().Name, config.Device.Name)
+		return
+	}
+
+	watchLog("deployed %s to %s", id, config.Device.Name)
+}
+
+// renewDraftLease renews the lease of the device held by the draft session. False is returned if the lease has been
+// taken over by another session, other errors are reported and the renewal is retried on the next tick.
+func renewDraftLease() bool {
+	_, err := releaser.Azure(newHubClient()).AcquireLease(config.Device.Name, draftLease(), false)
+	if _, ok := err.(*releaser.LeaseHeldError); ok {
+		watchLog("lease lost, stopped watching: %v", err)
+		return false
+	}
+
+	if err != nil {
+		watchLog("lease renewal failed: %v", err)
+	}
+
+	return true
+}
+
+// watchLog prints a timestamped status line for the watch command, the deployment errors it reports being redacted.
+func watchLog(format string, a ...interface{}) {
+	fmt.Printf("[%s] %s\n", time.Now().Format("15:04:05"), redactor.Redact(fmt.Sprintf(format, a...)))
+}
+
+// imageWatcher detects the new images pushed under the image reference of the draft module, e.g. by a CI pipeline.
+type imageWatcher struct {
+	// image and digest are the image reference and the digest of its manifest seen on the last check
+	image  string
+	digest string
+	// failing is true while the checks fail, so a failure is only reported once
+	failing bool
+}
+
+// changed reports whether the digest of the image changed since the last check. A change of the image reference itself
+// is a change of the configuration file, not reported here.
+func (w *imageWatcher) changed() bool {
+	image := config.MainModule().Image
+	digest, err := imageDigest(image)
+	if err != nil {
+		if !w.failing {
+			watchLog("image check failed: %v", err)
+		}
+		w.failing = true
+		return false
+	}
+
+	changed := w.image == image && w.digest != "" && w.digest != digest
+	w.image, w.digest, w.failing = image, digest, false
+	return changed
+}
+
+// draftWatcher keeps track of what the draft watch command is interested in. Files are watched through their parent
+// directory, since most editors replace files on save instead of writing them in place, which would otherwise drop the
+// watch on the file itself.
+type draftWatcher struct {
+	watcher *fsnotify.Watcher
+	// files holds the absolute paths of the individually watched files
+	files map[string]bool
+	// trees holds the absolute paths of the recursively watched directories
+	trees []string
+	// config holds the absolute path of the configuration file
+	config string
+}
+
+// addFile watches a single file through its parent directory.
+func (w *draftWatcher) addFile(p string) error {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
+
+	if w.config == "" {
+		w.config = abs
+	}
+
+	w.files[abs] = true
+	return w.watcher.Add(filepath.Dir(abs))
+}
+
+// addPath watches a file, or a directory and all its subdirectories.
+func (w *draftWatcher) addPath(p string) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return w.addFile(p)
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
+
+	w.trees = append(w.trees, abs)
+	return w.addDir(abs)
+}
+
+// addDir recursively watches a directory, hidden directories (e.g. .git) are skipped.
+func (w *draftWatcher) addDir(root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if p != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		return w.watcher.Add(p)
+	})
+}
+
+// changes returns the relevant changes of the watched files, true for a change of the configuration file. Directories
+// created inside a watched tree are watched as they appear.
+func (w *draftWatcher) changes() <-chan bool {
+	changes := make(chan bool)
+	go func() {
+		defer close(changes)
+		for {
+			select {
+			case event, ok := <-w.watcher.Events:
+				if !ok {
+					return
+				}
+
+				if !w.isRelevant(event) {
+					continue
+				}
+
+				if event.Has(fsnotify.Create) {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() && w.inWatchedTree(event.Name) {
+						w.addDir(event.Name)
+					}
+				}
+
+				watchLog("change detected: %s", event.Name)
+				changes <- w.isConfigFile(event.Name)
+			case err, ok := <-w.watcher.Errors:
+				if !ok {
+					return
+				}
+				watchLog("watch error: %v", err)
+			}
+		}
+	}()
+
+	return changes
+}
+
+// isRelevant reports whether an event should trigger a redeployment.
+func (w *draftWatcher) isRelevant(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+
+	abs, err := filepath.Abs(event.Name)
+	if err != nil {
+		return false
+	}
+
+	if w.files[abs] {
+		return true
+	}
+
+	return w.inWatchedTree(abs)
+}
+
+// inWatchedTree reports whether a path is inside one of the recursively watched directories.
+func (w *draftWatcher) inWatchedTree(p string) bool {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+
+	for _, root := range w.trees {
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			if strings.HasPrefix(part, ".") && part != "." {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// isConfigFile reports whether a path is the configuration file.
+func (w *draftWatcher) isConfigFile(p string) bool {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+
+	return abs == w.config
+}
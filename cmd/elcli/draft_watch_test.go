@@ -0,0 +1,63 @@
+package elcli
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDraftWatchLoop(t *testing.T) {
+	changes := make(chan bool)
+	poll := make(chan time.Time)
+	stop := make(chan os.Signal)
+
+	deploys := make(chan bool, 10)
+	var imageChanged atomic.Bool
+	l := draftWatchLoop{
+		debounce:     50 * time.Millisecond,
+		changes:      changes,
+		poll:         poll,
+		stop:         stop,
+		deploy:       func(reload bool) { deploys <- reload },
+		imageChanged: imageChanged.Load,
+		renewLease:   func() bool { return true },
+	}
+
+	done := make(chan struct{})
+	go func() {
+		l.run()
+		close(done)
+	}()
+
+	if reload := <-deploys; reload {
+		t.Error("expected the first deployment not to reload the configuration")
+	}
+
+	// a burst of changes results in a single deployment, reloading the configuration if it is part of the burst
+	for _, isConfig := range []bool{false, true, false, false, false} {
+		changes <- isConfig
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if reload := <-deploys; !reload {
+		t.Error("expected the configuration to be reloaded")
+	}
+
+	// an image check without a new image does not redeploy, a new image does
+	poll <- time.Now()
+	imageChanged.Store(true)
+	poll <- time.Now()
+
+	if reload := <-deploys; reload {
+		t.Error("expected a new image not to reload the configuration")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	stop <- os.Interrupt
+	<-done
+
+	if len(deploys) != 0 {
+		t.Errorf("expected 3 deployments, got %d more", len(deploys))
+	}
+}
@@ -0,0 +1,98 @@
+package elcli
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/unbrikd/edge-leap/internal/azure"
+	"github.com/unbrikd/edge-leap/internal/releaser"
+)
+
+// DEFAULT_LEASE_DURATION is the time a device lease lasts unless renewed.
+const DEFAULT_LEASE_DURATION = time.Hour
+
+// MIN_LEASE_DURATION is the shortest device lease, the lease being renewed a few times per duration while watching.
+const MIN_LEASE_DURATION = time.Second
+
+// leaseDuration is the time the device lease acquired by the draft commands lasts.
+var leaseDuration time.Duration
+
+// checkLeaseDuration exits if the lease duration given with --lease-duration is too short.
+func checkLeaseDuration() {
+	if leaseDuration < MIN_LEASE_DURATION {
+		errorf("error: --lease-duration must be at least %s\n", MIN_LEASE_DURATION)
+		os.Exit(1)
+	}
+}
+
+// addHubFlags adds the --hub and --token flags, selecting the IoT Hub and the token to authenticate its client. The hub
+// usage tells what the hub is used for by the command.
+func addHubFlags(flags *pflag.FlagSet, hubUsage string) {
+	flags.StringVar(&config.Infra.Hub, "hub", "", hubUsage)
+	flags.StringVar(&config.Auth.Token, "token", "", "token to authenticate the client")
+}
+
+// newHubClient returns a client of the configured IoT Hub, authenticated with the configured token.
+func newHubClient() *azure.Client {
+	return hubClient(config.Infra.Hub, config.Auth.Token)
+}
+
+// hubClient returns a client of an IoT Hub, authenticated with the given token.
+func hubClient(hub, token string) *azure.Client {
+	c := azure.NewClient(nil).WithAuthToken(token)
+	c.BaseURL, _ = url.Parse(fmt.Sprintf("https://%s/", hubHostName(hub)))
+
+	return c
+}
+
+// hubHostName returns the host name of an IoT Hub.
+func hubHostName(hub string) string {
+	return fmt.Sprintf("%s.azure-devices.net", hub)
+}
+
+// leaseOwner returns the identity written in the device leases, user@host.
+func leaseOwner() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return name
+	}
+
+	return fmt.Sprintf("%s@%s", name, host)
+}
+
+// draftLease returns the lease of the configured device for the current draft session, starting now.
+func draftLease() azure.Lease {
+	return azure.Lease{
+		Owner:     leaseOwner(),
+		Session:   config.Id,
+		Module:    config.MainModule().Name,
+		ExpiresAt: time.Now().Add(leaseDuration).UTC(),
+	}
+}
+
+// acquireDeviceLease acquires, or renews, the lease of the configured device for the current draft session. A lease
+// held by another session is only taken over with --force.
+func acquireDeviceLease(r *releaser.AzureReleaser) error {
+	replaced, err := r.AcquireLease(config.Device.Name, draftLease(), force)
+	if _, ok := err.(*releaser.LeaseHeldError); ok {
+		return fmt.Errorf("%v, use --force to take it over", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if replaced != nil {
+		errorf("warning: took over the lease of %s held by %s (session %s)\n", config.Device.Name, replaced.Owner, replaced.Session)
+	}
+
+	return nil
+}
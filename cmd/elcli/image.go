@@ -0,0 +1,158 @@
+package elcli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+	"github.com/unbrikd/edge-leap/internal/registry"
+)
+
+// DEVICE_PLATFORM_TAG is the device twin tag holding the platform of the device (e.g. linux/arm64).
+const DEVICE_PLATFORM_TAG = "platform"
+
+// newRegistryClient returns a registry client authenticated with the configuration credentials of the given registry.
+func newRegistryClient(server string) *registry.Client {
+	c := registry.NewClient(nil)
+	if r := config.RegistryFor(server); r != nil {
+		c.WithBasicAuth(r.Username, r.Password).WithBearerToken(r.Token)
+		c.Insecure = r.Insecure
+	}
+
+	return c
+}
+
+// pinImage resolves the tag of an image to the digest of its manifest for the given platform, or to the digest of the
+// image index if no platform is given. The pinned reference (repo@sha256:...) is returned along with the original tag.
+// References already holding a digest are returned untouched.
+func pinImage(image, platform string) (string, string, error) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return "", "", err
+	}
+
+	if ref.Digest != "" {
+		return image, ref.Tag, nil
+	}
+
+	digest, err := newRegistryClient(ref.Registry).Resolve(context.Background(), ref, platform)
+	if err != nil {
+		return "", "", err
+	}
+
+	return ref.Pinned(digest), ref.Tag, nil
+}
+
+// imageDigest returns the digest of the manifest an image reference points to, the image index for multi-platform
+// images.
+func imageDigest(image string) (string, error) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+
+	_, digest, err := newRegistryClient(ref.Registry).GetManifest(context.Background(), ref)
+	return digest, err
+}
+
+// verifyImage checks that an image exists in its registry and that the image is available for every given platform.
+// The errors are meant to be shown as is to the user.
+func verifyImage(image string, platforms []string) error {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return err
+	}
+
+	imagePlatforms, err := newRegistryClient(ref.Registry).Platforms(context.Background(), ref)
+	if err != nil {
+		return err
+	}
+
+	for _, platform := range platforms {
+		wanted, err := registry.ParsePlatform(platform)
+		if err != nil {
+			return err
+		}
+
+		if !platformAvailable(imagePlatforms, wanted) {
+			available := []string{}
+			for _, p := range imagePlatforms {
+				available = append(available, p.String())
+			}
+
+			return fmt.Errorf("image '%s' is not available for platform '%s' (available: %s)", image, wanted, strings.Join(available, ", "))
+		}
+	}
+
+	return nil
+}
+
+// platformAvailable reports whether one of the platforms of an image matches the wanted platform.
+func platformAvailable(platforms []registry.Platform, wanted *registry.Platform) bool {
+	for _, p := range platforms {
+		if p.Matches(wanted) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// targetPlatforms returns the platforms of the devices targeted by a deployment, declared in the platform tag of their
+// twin. The platform set in the configuration takes precedence, and the devices declaring no platform are left out.
+func targetPlatforms(c *azure.Client, targetCondition string) ([]string, error) {
+	if config.Device.Platform != "" {
+		return []string{config.Device.Platform}, nil
+	}
+
+	if targetCondition == "" {
+		return nil, nil
+	}
+
+	twins, res, err := c.Devices.QueryTwins(fmt.Sprintf("SELECT * FROM devices WHERE %s", targetCondition))
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the targeted devices: %v", err)
+	}
+
+	seen := map[string]bool{}
+	platforms := []string{}
+	for _, t := range twins {
+		if p, _ := t.Tag(DEVICE_PLATFORM_TAG).(string); p != "" && !seen[p] {
+			seen[p] = true
+			platforms = append(platforms, p)
+		}
+	}
+	sort.Strings(platforms)
+
+	return platforms, nil
+}
+
+// devicePlatform returns the platform of the configured device. The platform set in the configuration takes precedence
+// over the one declared in the device twin tags. An empty platform is returned if none is declared.
+func devicePlatform(c *azure.Client) (string, error) {
+	if config.Device.Platform != "" || config.Device.Name == "" {
+		return config.Device.Platform, nil
+	}
+
+	t, res, err := c.Devices.GetTwin(config.Device.Name)
+	if err != nil {
+		return "", err
+	}
+
+	if err = res.Expect(http.StatusOK); err != nil {
+		return "", fmt.Errorf("failed to get the device twin: %v", res.Response.Header["Iothub-Errorcode"])
+	}
+
+	p, _ := t.Tag(DEVICE_PLATFORM_TAG).(string)
+	return p, nil
+}
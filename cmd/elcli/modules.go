@@ -0,0 +1,35 @@
+package elcli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var modulesCmd = &cobra.Command{
+	Use:   "modules",
+	Short: "Inspect and configure the modules of a device",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(modulesCmd)
+
+	modulesCmd.PersistentFlags().StringVar(&config.Device.Name, "device", "", "the device running the modules (defaults to device.name)")
+	addHubFlags(modulesCmd.PersistentFlags(), "the name of the iot hub")
+}
+
+// loadModulesConfig loads the configuration of the modules commands, which need a device.
+func loadModulesConfig() {
+	if _, err := loadOptionalConfig(); err != nil {
+		errorf("error loading configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if config.Device.Name == "" {
+		errorf("error: a device is required, use --device or set device.name\n")
+		os.Exit(1)
+	}
+}
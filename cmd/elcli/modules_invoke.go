@@ -0,0 +1,99 @@
+package elcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+// DEFAULT_METHOD_RESPONSE_TIMEOUT is the time the hub waits for the result of a direct method by default.
+const DEFAULT_METHOD_RESPONSE_TIMEOUT = 30 * time.Second
+
+var (
+	// methodPayload is the JSON payload of the invoked direct method.
+	methodPayload string
+	// methodPayloadFile is the JSON file holding the payload of the invoked direct method.
+	methodPayloadFile string
+	// connectTimeout is the time the hub waits for the device to connect before failing the invocation.
+	connectTimeout time.Duration
+	// responseTimeout is the time the hub waits for the result of the direct method.
+	responseTimeout time.Duration
+)
+
+var modulesInvokeCmd = &cobra.Command{
+	Use:   "invoke <module> <method>",
+	Short: "Invoke a direct method of a module",
+	Long: `Invokes a direct method of a module of the device and prints its status and payload. The built-in methods of the
+edge runtime are implemented by the $edgeAgent module, e.g. elcli modules invoke '$edgeAgent' ping. The payload is
+given as JSON with --payload or read from a file with --payload-file. The command fails when the method returns a
+status outside of the 2xx range.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		loadModulesConfig()
+		executeModulesInvoke(args[0], args[1])
+	},
+}
+
+func init() {
+	modulesCmd.AddCommand(modulesInvokeCmd)
+
+	modulesInvokeCmd.Flags().StringVar(&methodPayload, "payload", "", "JSON payload of the method")
+	modulesInvokeCmd.Flags().StringVar(&methodPayloadFile, "payload-file", "", "JSON file holding the payload of the method")
+	modulesInvokeCmd.Flags().DurationVar(&connectTimeout, "connect-timeout", 0, "time to wait for the device to connect")
+	modulesInvokeCmd.Flags().DurationVar(&responseTimeout, "response-timeout", DEFAULT_METHOD_RESPONSE_TIMEOUT, "time to wait for the result of the method")
+	modulesInvokeCmd.MarkFlagsMutuallyExclusive("payload", "payload-file")
+}
+
+// executeModulesInvoke invokes a direct method of a module and prints its result.
+func executeModulesInvoke(module, method string) {
+	raw := []byte(methodPayload)
+	if methodPayloadFile != "" {
+		b, err := os.ReadFile(methodPayloadFile)
+		if err != nil {
+			errorf("error reading the method payload: %v\n", err)
+			os.Exit(1)
+		}
+		raw = b
+	}
+
+	var payload interface{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			errorf("error: invalid method payload: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	m := azure.NewMethodInvocation(method, payload, connectTimeout, responseTimeout)
+	result, res, err := newHubClient().Devices.InvokeModuleMethod(config.Device.Name, module, m)
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		errorf("error invoking method '%s' of module '%s': %v\n", method, module, err)
+		os.Exit(1)
+	}
+
+	printMethodResult(result)
+	if result.Status < 200 || result.Status > 299 {
+		os.Exit(1)
+	}
+}
+
+// printMethodResult prints the status of a direct method and its payload as indented JSON.
+func printMethodResult(result *azure.MethodResult) {
+	fmt.Printf("status: %d\n", result.Status)
+
+	var v interface{}
+	if len(result.Payload) == 0 || json.Unmarshal(result.Payload, &v) != nil || v == nil {
+		return
+	}
+
+	b, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(b))
+}
@@ -0,0 +1,78 @@
+package elcli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var modulesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the modules of a device",
+	Long: `Lists the module identities of a device, with the runtime status of the modules reported by the edge agent of the
+device.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		loadModulesConfig()
+		executeModulesList()
+	},
+}
+
+func init() {
+	modulesCmd.AddCommand(modulesListCmd)
+}
+
+// executeModulesList prints the modules of the device and their runtime status.
+func executeModulesList() {
+	c := newHubClient()
+
+	modules, res, err := c.Devices.ListModules(config.Device.Name)
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		errorf("error listing the modules of '%s': %v\n", config.Device.Name, err)
+		os.Exit(1)
+	}
+
+	// the runtime status is only reported by the edge agent of edge devices
+	statuses := map[string]string{}
+	if agent, res, err := c.Devices.GetModuleTwin(config.Device.Name, "$edgeAgent"); err == nil && res.Is(http.StatusOK) && agent.Properties != nil {
+		for _, section := range []string{"systemModules", "modules"} {
+			reported, _ := agent.Properties.Reported[section].(map[string]interface{})
+			for name, m := range reported {
+				status, _ := m.(map[string]interface{})["runtimeStatus"].(string)
+				statuses[name] = status
+				// the system modules are reported without their $ prefix
+				if section == "systemModules" {
+					statuses["$"+name] = status
+				}
+			}
+		}
+	}
+
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].ModuleId < modules[j].ModuleId
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tRUNTIME STATUS\tCONNECTION\tMANAGED BY\tLAST ACTIVITY")
+	for _, m := range modules {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.ModuleId, orDash(statuses[m.ModuleId]), strings.ToLower(m.ConnectionState), orDash(m.ManagedBy), activityTime(m.LastActivityTime))
+	}
+
+	w.Flush()
+}
+
+// orDash returns the string, a dash if it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
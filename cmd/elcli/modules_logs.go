@@ -0,0 +1,102 @@
+package elcli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+// DEFAULT_LOGS_INTERVAL is the time between two fetches of the module logs when following them.
+const DEFAULT_LOGS_INTERVAL = 5 * time.Second
+
+var (
+	// logsFilter selects the lines of the module logs fetched.
+	logsFilter azure.LogsFilter
+	// followLogs keeps fetching the new lines of the module logs.
+	followLogs bool
+	// logsInterval is the time between two fetches of the module logs when following them.
+	logsInterval time.Duration
+)
+
+var modulesLogsCmd = &cobra.Command{
+	Use:   "logs <module>",
+	Short: "Print the logs of a module",
+	Long: `Prints the logs of a module of the device, fetched through the GetModuleLogs method of the edge agent, so no access
+to the device is needed. The lines are printed with their timestamp and severity. --since and --until take durations
+(e.g. 10m), RFC3339 or UNIX timestamps, --filter a regular expression matching the lines, and --follow keeps polling
+the device for new lines every --interval.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		loadModulesConfig()
+		executeLogs(args[0])
+	},
+}
+
+func init() {
+	modulesCmd.AddCommand(modulesLogsCmd)
+
+	addLogsFlags(modulesLogsCmd)
+}
+
+// addLogsFlags adds the flags selecting the module logs to a command.
+func addLogsFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&logsFilter.Since, "since", "", "print the lines since a duration or a timestamp")
+	cmd.Flags().StringVar(&logsFilter.Until, "until", "", "print the lines until a duration or a timestamp")
+	cmd.Flags().IntVar(&logsFilter.Tail, "tail", 0, "number of lines to print from the end of the logs")
+	cmd.Flags().StringVar(&logsFilter.Regex, "filter", "", "regular expression the printed lines match")
+	cmd.Flags().BoolVar(&followLogs, "follow", false, "keep printing the new lines")
+	cmd.Flags().DurationVar(&logsInterval, "interval", DEFAULT_LOGS_INTERVAL, "time between two fetches of the logs when following them")
+	cmd.MarkFlagsMutuallyExclusive("follow", "until")
+}
+
+// executeLogs prints the logs of a module of the device, and the new lines every interval when following them. The
+// lines fetched again, since the hub only filters by second, are skipped.
+func executeLogs(module string) {
+	c := newHubClient()
+	filter := logsFilter
+
+	var last time.Time
+	seen := map[string]bool{}
+	for {
+		messages, res, err := c.Devices.GetModuleLogs(config.Device.Name, module, filter, DEFAULT_METHOD_RESPONSE_TIMEOUT)
+		if err == nil {
+			err = res.Expect(http.StatusOK)
+		}
+		if err != nil {
+			errorf("error getting the logs of module '%s': %v\n", module, err)
+			os.Exit(1)
+		}
+
+		for _, m := range messages {
+			key := m.Timestamp.String() + m.Text
+			if m.Timestamp.Before(last) || seen[key] {
+				continue
+			}
+
+			if m.Timestamp.After(last) {
+				last = m.Timestamp
+				seen = map[string]bool{}
+			}
+			seen[key] = true
+
+			fmt.Printf("%s %-7s %s\n", m.Timestamp.Local().Format("2006-01-02T15:04:05.000"), m.Severity(), m.Text)
+		}
+
+		if !followLogs {
+			return
+		}
+
+		time.Sleep(logsInterval)
+
+		// the next fetches only return the new lines
+		filter.Tail = 0
+		if !last.IsZero() {
+			filter.Since = strconv.FormatInt(last.Unix(), 10)
+		}
+	}
+}
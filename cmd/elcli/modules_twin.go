@@ -0,0 +1,161 @@
+package elcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// twinProperties selects the properties of the module twin printed, desired or reported.
+	twinProperties string
+	// desiredFile is the JSON file holding the desired properties patch of a module twin.
+	desiredFile string
+)
+
+var modulesTwinCmd = &cobra.Command{
+	Use:   "twin",
+	Short: "Read and update module twins",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var modulesTwinGetCmd = &cobra.Command{
+	Use:   "get <module>",
+	Short: "Print the twin of a module",
+	Long: `Prints the twin of a module of the device as JSON, only its desired or reported properties with --properties. The
+state of the edge runtime is read from the reported properties of the $edgeAgent and $edgeHub modules, e.g.
+elcli modules twin get '$edgeAgent' --properties reported.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		loadModulesConfig()
+		executeModulesTwinGet(args[0])
+	},
+}
+
+var modulesTwinSetCmd = &cobra.Command{
+	Use:   "set <module> [key=value]...",
+	Short: "Update the desired properties of a module twin",
+	Long: `Updates the desired properties of a module twin, so a running module can be reconfigured without redeploying it.
+Properties are given as key=value pairs, nested properties with dotted keys (e.g. logging.level=debug), and values are
+read as JSON when valid (numbers, booleans, objects), as strings otherwise. A property set to null is removed. The
+patch can also be read from a JSON file with --file, the pairs being applied on top of it.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		loadModulesConfig()
+		executeModulesTwinSet(args[0], args[1:])
+	},
+}
+
+func init() {
+	modulesCmd.AddCommand(modulesTwinCmd)
+	modulesTwinCmd.AddCommand(modulesTwinGetCmd)
+	modulesTwinCmd.AddCommand(modulesTwinSetCmd)
+
+	modulesTwinGetCmd.Flags().StringVar(&twinProperties, "properties", "", "print only the desired or the reported properties")
+	modulesTwinSetCmd.Flags().StringVar(&desiredFile, "file", "", "JSON file holding the desired properties patch")
+}
+
+// executeModulesTwinGet prints the twin of a module, or a section of its properties.
+func executeModulesTwinGet(module string) {
+	twin, res, err := newHubClient().Devices.GetModuleTwinDocument(config.Device.Name, module)
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		errorf("error getting the twin of module '%s': %v\n", module, err)
+		os.Exit(1)
+	}
+
+	var v interface{} = twin
+	switch twinProperties {
+	case "":
+	case "desired", "reported":
+		v = map[string]interface{}{}
+		if properties, ok := twin["properties"].(map[string]interface{}); ok && properties[twinProperties] != nil {
+			v = properties[twinProperties]
+		}
+	default:
+		errorf("error: invalid properties '%s', expected desired or reported\n", twinProperties)
+		os.Exit(1)
+	}
+
+	b, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(b))
+}
+
+// executeModulesTwinSet patches the desired properties of a module twin.
+func executeModulesTwinSet(module string, pairs []string) {
+	patch := map[string]interface{}{}
+	if desiredFile != "" {
+		b, err := os.ReadFile(desiredFile)
+		if err == nil {
+			err = json.Unmarshal(b, &patch)
+		}
+		if err != nil {
+			errorf("error reading the desired properties patch: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := setPairs(patch, pairs); err != nil {
+		errorf("error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(patch) == 0 {
+		errorf("error: no desired property to set, give key=value pairs or --file\n")
+		os.Exit(1)
+	}
+
+	twin, res, err := newHubClient().Devices.UpdateModuleDesired(config.Device.Name, module, patch, "")
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		errorf("error updating the twin of module '%s': %v\n", module, err)
+		os.Exit(1)
+	}
+
+	version := interface{}("-")
+	if twin.Properties != nil {
+		version = twin.Properties.Desired["$version"]
+	}
+
+	fmt.Printf("desired properties of %s/%s updated, version %v\n", config.Device.Name, module, version)
+}
+
+// setPairs sets key=value pairs in a twin patch, of desired properties or tags. Dotted keys set nested values and
+// values are read as JSON when valid, as strings otherwise.
+func setPairs(patch map[string]interface{}, pairs []string) error {
+	for _, p := range pairs {
+		k, raw, found := strings.Cut(p, "=")
+		if !found || k == "" {
+			return fmt.Errorf("invalid pair '%s', expected key=value", p)
+		}
+
+		var v interface{}
+		if err := json.Unmarshal([]byte(raw), &v); err != nil {
+			v = raw
+		}
+
+		m := patch
+		keys := strings.Split(k, ".")
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := m[key].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				m[key] = child
+			}
+			m = child
+		}
+		m[keys[len(keys)-1]] = v
+	}
+
+	return nil
+}
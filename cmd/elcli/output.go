@@ -0,0 +1,18 @@
+package elcli
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// errorOutput is where the error and warning messages of the commands are written, stderr so they do not mix with the
+// command output (e.g. deployment ids or JSON).
+var errorOutput io.Writer = os.Stderr
+
+// errorf prints an error message of a command, the secrets of the configuration, the tokens and the keys given in the
+// command line being redacted. Every error message goes through it, since errors returned by the clients may quote
+// the values they were given.
+func errorf(format string, a ...interface{}) {
+	fmt.Fprint(errorOutput, redactor.Redact(fmt.Sprintf(format, a...)))
+}
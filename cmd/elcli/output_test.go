@@ -0,0 +1,30 @@
+package elcli
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+func TestErrorf(t *testing.T) {
+	output, r := errorOutput, redactor
+	t.Cleanup(func() {
+		errorOutput, redactor = output, r
+	})
+
+	var out bytes.Buffer
+	errorOutput = &out
+	redactor = configuration.NewRedactor([]string{"SharedAccessSignature sr=hub&sig=abc"})
+
+	// secrets added by the commands, e.g. the device keys, are redacted as well
+	redactor.Add("device-key==")
+
+	errorf("error creating device '%s': %v\n", "dev", errors.New("invalid key device-key== for token SharedAccessSignature sr=hub&sig=abc"))
+
+	expected := "error creating device 'dev': invalid key " + configuration.REDACTED + " for token " + configuration.REDACTED + "\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,63 @@
+package elcli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// prompter asks questions to the user on the terminal.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	// eof is set once the input is closed, every following question is answered with its default value.
+	eof bool
+}
+
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	return &prompter{in: bufio.NewReader(in), out: out}
+}
+
+// ask prints the question with its default value and returns the answer, the default value if the answer is empty.
+func (p *prompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+
+	line, err := p.in.ReadString('\n')
+	if err != nil {
+		p.eof = true
+		fmt.Fprintln(p.out)
+	}
+
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer
+	}
+
+	return def
+}
+
+// askList asks the question until the answer is empty and returns the answers.
+func (p *prompter) askList(question string) []string {
+	answers := []string{}
+	for {
+		answer := p.ask(question, "")
+		if answer != "" {
+			answers = append(answers, answer)
+		}
+
+		if answer == "" || p.eof {
+			return answers
+		}
+	}
+}
+
+// isTerminal reports whether the file is a terminal, so the user can be prompted.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
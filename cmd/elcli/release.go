@@ -2,24 +2,31 @@ package elcli
 
 import (
 	"fmt"
-	"net/url"
 	"os"
 	"strings"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"github.com/unbrikd/edge-leap/internal/azure"
+	"github.com/unbrikd/edge-leap/internal/condition"
 	"github.com/unbrikd/edge-leap/internal/releaser"
-	"github.com/unbrikd/edge-leap/internal/utils"
 )
 
+var pinDigest bool
+
 // releaseCmd represents the release command
 var releaseCmd = &cobra.Command{
 	Use:   "release",
 	Short: "Handles the release of an application",
 	Run: func(cmd *cobra.Command, args []string) {
-		loadConfig()
+		if _, err := loadConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		if err := applyModuleFlags(cmd.Flags()); err != nil {
+			errorf("error applying flags: %v\n", err)
+			os.Exit(1)
+		}
 		executeRelease()
 	},
 }
@@ -28,55 +35,64 @@ func init() {
 	rootCmd.AddCommand(releaseCmd)
 
 	// Deployment configuration
-	releaseCmd.Flags().StringVar(&config.Deployment.Id, "id", viper.GetString("deployment.id"), "id to use for deployment (must be kebab-case)")
-	viper.BindPFlag("deployment.id", releaseCmd.Flags().Lookup("id"))
+	releaseCmd.Flags().StringVar(&config.Deployment.Id, "id", "", "id to use for deployment (must be kebab-case)")
 
 	releaseCmd.Flags().Int16VarP(&config.Deployment.Priority, "priority", "p", 50, "module deployment priority")
-	viper.BindPFlag("deployment.priority", releaseCmd.Flags().Lookup("priority"))
 
-	releaseCmd.Flags().StringVarP(&config.Deployment.TargetCondition, "target-condition", "t", viper.GetString("deployment.target-condition"), "target condition for the deployment")
-	viper.BindPFlag("deployment.target-condition", releaseCmd.Flags().Lookup("target-condition"))
+	releaseCmd.Flags().StringVarP(&config.Deployment.TargetCondition, "target-condition", "t", "", "target condition for the deployment")
 
 	// Device configuration
-	releaseCmd.Flags().StringVar(&config.Device.Name, "device-name", viper.GetString("device.name"), "device name to deploy the module to")
-	viper.BindPFlag("device.name", releaseCmd.Flags().Lookup("device-name"))
-
-	// Module configuration
-	releaseCmd.Flags().StringVarP(&config.Module.Name, "module-name", "m", viper.GetString("module.name"), "desired module name to show in the iotedge list (must be camelCase)")
-	viper.BindPFlag("module.name", releaseCmd.Flags().Lookup("module-name"))
-
-	releaseCmd.Flags().StringVar(&config.Module.CreateOptions, "create-options", viper.GetString("module.create-options"), "runtime settings for the container of the module (json string)")
-	viper.BindPFlag("module.create-options", releaseCmd.Flags().Lookup("create-options"))
+	releaseCmd.Flags().StringVar(&config.Device.Name, "device-name", "", "device name to deploy the module to")
 
-	releaseCmd.Flags().IntVarP(&config.Module.StartupOrder, "startup-order", "s", viper.GetInt("module.startup-order"), "module startup order")
-	viper.BindPFlag("module.startup-order", releaseCmd.Flags().Lookup("startup-order"))
+	// Module configuration, applied to the main module
+	releaseCmd.Flags().StringVarP(&moduleFlags.Name, "module-name", "m", "", "desired module name to show in the iotedge list (must be camelCase)")
+	releaseCmd.Flags().StringVar(&moduleFlags.CreateOptions, "create-options", "", "runtime settings for the container of the module (json string)")
+	releaseCmd.Flags().IntVarP(&moduleFlags.StartupOrder, "startup-order", "s", 0, "module startup order")
+	releaseCmd.Flags().StringVarP(&moduleFlags.Image, "image", "i", "", "module image URL (must be a valid docker image URL)")
+	releaseCmd.Flags().StringArrayVarP(&moduleFlags.Env, "env", "e", nil, "environment variables for the module (key=value), overrides the env files and the configuration")
+	releaseCmd.Flags().StringArrayVar(&envFiles, "env-file", nil, "dotenv file to read the module environment variables from, overrides the configuration (can be repeated, later files win)")
 
-	releaseCmd.Flags().StringVarP(&config.Module.Image, "image", "i", viper.GetString("module.image"), "module image URL (must be a valid docker image URL)")
-	viper.BindPFlag("module.image", releaseCmd.Flags().Lookup("image"))
+	releaseCmd.Flags().BoolVar(&pinDigest, "pin-digest", false, "resolve the image tag to its digest in the registry and release the pinned image")
+	releaseCmd.Flags().BoolVar(&skipImageCheck, "skip-image-check", false, "do not verify the image exists in the registry for the device platform before releasing")
 
-	releaseCmd.Flags().StringSliceVarP(&config.Module.Env, "env", "e", nil, "environment variables for the module (key=value)")
-	viper.BindPFlag("module.env", releaseCmd.Flags().Lookup("env"))
+	releaseCmd.Flags().BoolVar(&resumeRollout, "resume", false, "go on with the rollout in progress of the deployment")
+	releaseCmd.Flags().BoolVar(&abortRollout, "abort", false, "roll back the rollout in progress of the deployment")
+	releaseCmd.MarkFlagsMutuallyExclusive("resume", "abort")
 
-	// Infra configuration
-	releaseCmd.Flags().StringVar(&config.Infra.Hub, "hub", "", "the name of the iot hub to send the deployment to")
-	viper.BindPFlag("infra.hub", releaseCmd.Flags().Lookup("hub"))
+	releaseCmd.Flags().IntVar(&fanOutWorkers, "parallel", DEFAULT_FAN_OUT_WORKERS, "number of hubs of infra.hubs released to concurrently")
+	releaseCmd.Flags().BoolVar(&allOrNothing, "all-or-nothing", false, "roll back the hubs of infra.hubs released when the release to a hub fails")
+	releaseCmd.Flags().StringVar(&reportFile, "report", "", "file to write the JSON report of the release to infra.hubs to")
 
-	// Auth configuration
-	releaseCmd.Flags().StringVar(&config.Auth.Token, "token", "", "token to authenticate the client")
-	viper.BindPFlag("auth.token", releaseCmd.Flags().Lookup("token"))
+	// Infra and auth configuration
+	addHubFlags(releaseCmd.Flags(), "the name of the iot hub to send the deployment to")
 }
 
 // executeRelease handles the release of a module taking the configuration file or the flags.
 // The flags have precedence over the configuration file.
 func executeRelease() {
-	moduleEnv, err := utils.StringArraySplitToMap(config.Module.Env, "=")
-	if err != nil {
-		fmt.Printf("failed to parse environment variables: %v", err)
-		os.Exit(1)
+	c := newHubClient()
+	if len(config.Infra.Hubs) > 0 {
+		if len(config.Rollout.Steps) > 0 {
+			errorf("error: releases to several hubs cannot be rolled out, rollouts release to a single hub\n")
+			os.Exit(1)
+		}
+
+		// the device platform is read from the first hub
+		c = hubClient(config.Infra.Hubs[0].Name, tokenOr(config.Infra.Hubs[0].Token))
+	}
+
+	if resumeRollout || abortRollout {
+		executeResumeRollout(releaser.Azure(c))
+		return
 	}
 
-	c := azure.NewClient(nil).WithAuthToken(config.Auth.Token)
-	c.BaseURL, _ = url.Parse(fmt.Sprintf("https://%s.azure-devices.net/", config.Infra.Hub))
+	// the configuration validation only checks the quotes and parentheses, the condition is fully parsed before the release
+	if config.Deployment.TargetCondition != "" {
+		if _, err := condition.Parse(config.Deployment.TargetCondition); err != nil {
+			errorf("invalid target condition: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	releaseId := strings.Split(uuid.New().String(), "-")[4]
 	d := azure.Configuration{
@@ -86,12 +102,73 @@ func executeRelease() {
 		Labels: map[string]string{
 			"releaseId": releaseId},
 	}
-	d.SetContent(config.Module.Name, config.Module.Image, config.Module.CreateOptions, config.Module.StartupOrder, moduleEnv)
+
+	if len(config.Deployment.Metrics) > 0 {
+		d.Metrics = &azure.ConfigurationMetrics{Queries: map[string]string{}}
+		for _, m := range config.Deployment.Metrics {
+			d.Metrics.Queries[m.Name] = m.Query
+		}
+	}
+
+	// the images must be available for the platform of every targeted device
+	if !skipImageCheck {
+		platforms, err := targetPlatforms(c, d.TargetCondition)
+		if err != nil {
+			errorf("failed to get the device platforms: %v\n", err)
+			os.Exit(1)
+		}
+
+		for _, image := range moduleImages(nil) {
+			if err := verifyImage(image, platforms); err != nil {
+				errorf("image check failed: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	// a mutable tag could make devices run different code, the images are pinned to the digest the tags point to now. The
+	// digest of the image index is used, so every device of a multi-platform fleet still pulls the image of its platform.
+	pinned := map[string]string{}
+	if pinDigest {
+		for i, m := range config.Modules {
+			image, tag, err := pinImage(m.Image, "")
+			if err != nil {
+				errorf("failed to resolve image digest: %v\n", err)
+				os.Exit(1)
+			}
+			pinned[m.Name] = image
+
+			if tag == "" {
+				continue
+			}
+
+			// the main module keeps the label used by single module configurations
+			if i == 0 {
+				d.Labels["imageTag"] = tag
+			} else {
+				d.Labels[fmt.Sprintf("imageTag.%s", m.Name)] = tag
+			}
+		}
+	}
+
+	if err := setDeploymentContent(&d, pinned); err != nil {
+		errorf("failed to set deployment content: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(config.Infra.Hubs) > 0 {
+		executeFanOut(&d)
+		return
+	}
 
 	r := releaser.Azure(c)
-	err = r.ReleaseModule(&d)
-	if err != nil {
-		fmt.Printf("failed to release module: %v", err)
+	if len(config.Rollout.Steps) > 0 {
+		executeRollout(r, &d)
+		return
+	}
+
+	if err := r.ReleaseModule(&d); err != nil {
+		errorf("failed to release module: %v", err)
 		os.Exit(1)
 	}
 
@@ -0,0 +1,79 @@
+package elcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+	"github.com/unbrikd/edge-leap/internal/releaser"
+)
+
+// DEFAULT_FAN_OUT_WORKERS is the number of hubs released to concurrently.
+const DEFAULT_FAN_OUT_WORKERS = 4
+
+var (
+	// fanOutWorkers is the number of hubs released to concurrently.
+	fanOutWorkers int
+	// allOrNothing rolls back the hubs released when the release to a hub fails.
+	allOrNothing bool
+	// reportFile is the file the JSON report of the release is written to.
+	reportFile string
+)
+
+// releaseReport is the machine-readable report of a release to several hubs.
+type releaseReport struct {
+	DeploymentId string      `json:"deploymentId"`
+	ReleaseId    string      `json:"releaseId"`
+	AllOrNothing bool        `json:"allOrNothing"`
+	Success      bool        `json:"success"`
+	Hubs         []hubReport `json:"hubs"`
+}
+
+// hubReport is the result of the release to a hub in the report.
+type hubReport struct {
+	Hub        string `json:"hub"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// executeFanOut releases a deployment to every hub of the configuration, prints the result of every hub and writes the
+// report of the release when asked.
+func executeFanOut(d *azure.Configuration) {
+	hubs := []releaser.HubReleaser{}
+	for _, h := range config.Infra.Hubs {
+		hubs = append(hubs, releaser.HubReleaser{Hub: h.Name, Releaser: releaser.Azure(hubClient(h.Name, tokenOr(h.Token)))})
+	}
+
+	results := releaser.FanOut(hubs, d, fanOutWorkers, allOrNothing)
+
+	report := releaseReport{DeploymentId: d.Id, ReleaseId: d.Labels["releaseId"], AllOrNothing: allOrNothing, Success: true}
+	for _, r := range results {
+		report.Success = report.Success && r.Status == releaser.HUB_RELEASED
+		report.Hubs = append(report.Hubs, hubReport{Hub: r.Hub, Status: r.Status, Error: redactor.Redact(r.Error), DurationMs: r.Duration.Milliseconds()})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HUB\tSTATUS\tDURATION\tERROR")
+	for _, h := range report.Hubs {
+		fmt.Fprintf(w, "%s\t%s\t%dms\t%s\n", h.Hub, h.Status, h.DurationMs, h.Error)
+	}
+	w.Flush()
+
+	if reportFile != "" {
+		b, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(reportFile, append(b, '\n'), 0644); err != nil {
+			errorf("failed to write the report: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if !report.Success {
+		errorf("%s, release %s failed on some hubs\n", config.Deployment.Id, report.ReleaseId)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s, release %s\n", config.Deployment.Id, report.ReleaseId)
+}
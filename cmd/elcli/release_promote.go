@@ -0,0 +1,113 @@
+package elcli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/unbrikd/edge-leap/internal/releaser"
+	"github.com/unbrikd/edge-leap/internal/utils"
+)
+
+var (
+	// promoteFrom and promoteTo are the names of the hubs a release is promoted from and to.
+	promoteFrom, promoteTo string
+	// promoteFromToken and promoteToToken authenticate the clients of the hubs, the configured token is used if empty.
+	promoteFromToken, promoteToToken string
+)
+
+var releasePromoteCmd = &cobra.Command{
+	Use:   "promote <releaseId>",
+	Short: "Promotes a release from a hub to another",
+	Long: `Promotes a tested release from a hub (e.g. staging) to another (e.g. prod). The exact content of the release is read
+from the source hub and released on the destination hub with the settings of the configuration for the destination,
+usually selected with --environment: the target condition, the priority and the environment variables of the modules,
+which are merged into the ones of the release. The source hub and the time of the promotion are recorded in the
+promotedFrom and promotedAt labels of the deployment.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := loadConfig(); err != nil {
+			errorf("error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		if err := applyModuleFlags(cmd.Flags()); err != nil {
+			errorf("error applying flags: %v\n", err)
+			os.Exit(1)
+		}
+		executeReleasePromote(args[0])
+	},
+}
+
+func init() {
+	releaseCmd.AddCommand(releasePromoteCmd)
+
+	releasePromoteCmd.Flags().StringVar(&promoteFrom, "from", "", "the name of the iot hub to promote the release from")
+	releasePromoteCmd.Flags().StringVar(&promoteTo, "to", "", "the name of the iot hub to promote the release to")
+	releasePromoteCmd.Flags().StringVar(&promoteFromToken, "from-token", "", "token to authenticate the client of the source hub (defaults to the configured token)")
+	releasePromoteCmd.Flags().StringVar(&promoteToToken, "to-token", "", "token to authenticate the client of the destination hub (defaults to the configured token)")
+	releasePromoteCmd.MarkFlagRequired("from")
+	releasePromoteCmd.MarkFlagRequired("to")
+
+	releasePromoteCmd.Flags().StringVar(&config.Deployment.Id, "id", "", "id of the deployment (must be kebab-case)")
+	releasePromoteCmd.Flags().Int16VarP(&config.Deployment.Priority, "priority", "p", 50, "module deployment priority on the destination hub")
+	releasePromoteCmd.Flags().StringVarP(&config.Deployment.TargetCondition, "target-condition", "t", "", "target condition of the deployment on the destination hub")
+	releasePromoteCmd.Flags().StringArrayVarP(&moduleFlags.Env, "env", "e", nil, "environment variables for the main module (key=value), overrides the env files and the configuration")
+	releasePromoteCmd.Flags().StringArrayVar(&envFiles, "env-file", nil, "dotenv file to read the main module environment variables from, overrides the configuration (can be repeated, later files win)")
+
+	releasePromoteCmd.Flags().StringVar(&config.Auth.Token, "token", "", "token to authenticate the clients of both hubs")
+}
+
+// executeReleasePromote promotes a release of the deployment from the source hub to the destination hub.
+func executeReleasePromote(releaseId string) {
+	redactor.Add(promoteFromToken, promoteToToken)
+
+	src := releaser.Azure(hubClient(promoteFrom, tokenOr(promoteFromToken)))
+	d, err := src.FindRelease(config.Deployment.Id, releaseId)
+	if err != nil {
+		errorf("failed to read the release from %s: %v\n", promoteFrom, err)
+		os.Exit(1)
+	}
+
+	d.Priority = config.Deployment.Priority
+	if config.Deployment.TargetCondition != "" {
+		d.TargetCondition = config.Deployment.TargetCondition
+	}
+
+	for _, m := range config.Modules {
+		env, err := utils.StringArraySplitToMap(m.Env, "=")
+		if err != nil {
+			errorf("failed to parse environment variables of module %s: %v\n", m.Name, err)
+			os.Exit(1)
+		}
+
+		if !d.MergeModuleEnv(m.Name, env) && len(env) > 0 {
+			errorf("warning: module %s is not part of release %s, its environment variables are ignored\n", m.Name, releaseId)
+		}
+	}
+
+	d.Labels["promotedFrom"] = promoteFrom
+	d.Labels["promotedAt"] = time.Now().UTC().Format("20060102T150405Z")
+
+	dst := releaser.Azure(hubClient(promoteTo, tokenOr(promoteToToken)))
+	if len(config.Rollout.Steps) > 0 {
+		executeRollout(dst, d)
+		return
+	}
+
+	if err := dst.ReleaseModule(d); err != nil {
+		errorf("failed to release module on %s: %v\n", promoteTo, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s, release %s promoted from %s to %s\n", config.Deployment.Id, releaseId, promoteFrom, promoteTo)
+}
+
+// tokenOr returns the token, the configured token if it is empty.
+func tokenOr(token string) string {
+	if token != "" {
+		return token
+	}
+
+	return config.Auth.Token
+}
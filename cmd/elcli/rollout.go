@@ -0,0 +1,132 @@
+package elcli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+	"github.com/unbrikd/edge-leap/internal/releaser"
+)
+
+// DEFAULT_ROLLOUT_TIMEOUT is the time after which a rollout step which is not healthy is rolled back.
+const DEFAULT_ROLLOUT_TIMEOUT = 30 * time.Minute
+
+// DEFAULT_ROLLOUT_INTERVAL is the time between two health checks of a rollout step.
+const DEFAULT_ROLLOUT_INTERVAL = 30 * time.Second
+
+// DEFAULT_ROLLOUT_MIN_HEALTHY is the percentage of the devices of a rollout step which must run the release.
+const DEFAULT_ROLLOUT_MIN_HEALTHY = 100
+
+var (
+	// resumeRollout resumes the rollout in progress instead of releasing.
+	resumeRollout bool
+	// abortRollout rolls back the rollout in progress instead of releasing.
+	abortRollout bool
+)
+
+// rolloutPlan returns the rollout plan of the configuration, the defaults applying to the missing settings.
+func rolloutPlan() releaser.RolloutPlan {
+	r := config.Rollout
+	plan := releaser.RolloutPlan{
+		TargetCondition: config.Deployment.TargetCondition,
+		RingTag:         r.RingTag,
+		MinHealthy:      r.Health.MinHealthy,
+		MaxFailed:       r.Health.MaxFailed,
+		Timeout:         duration(r.Health.Timeout, DEFAULT_ROLLOUT_TIMEOUT),
+		Interval:        duration(r.Health.Interval, DEFAULT_ROLLOUT_INTERVAL),
+	}
+
+	if plan.MinHealthy == 0 {
+		plan.MinHealthy = DEFAULT_ROLLOUT_MIN_HEALTHY
+	}
+
+	for _, s := range r.Steps {
+		plan.Steps = append(plan.Steps, releaser.RolloutStep{Name: s.Name, Percent: s.Percent, Ring: s.Ring, Wait: duration(s.Wait, 0)})
+	}
+
+	return plan
+}
+
+// duration parses a duration of the configuration, validated beforehand, returning def if it is empty.
+func duration(s string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return def
+	}
+
+	return d
+}
+
+// executeRollout rolls out a release following the rollout plan of the configuration, to the target of the release.
+func executeRollout(r *releaser.AzureReleaser, d *azure.Configuration) {
+	plan := rolloutPlan()
+	plan.TargetCondition = d.TargetCondition
+
+	rollout, err := r.StartRollout(d, plan)
+	var inProgress *releaser.RolloutInProgressError
+	if errors.As(err, &inProgress) {
+		errorf("%v, use --resume to go on with it or --abort to roll it back\n", err)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		errorf("failed to start the rollout: %v\n", err)
+		os.Exit(1)
+	}
+
+	runRollout(rollout)
+}
+
+// executeResumeRollout resumes or rolls back the rollout in progress of the deployment.
+func executeResumeRollout(r *releaser.AzureReleaser) {
+	rollout, err := r.ResumeRollout(config.Deployment.Id, rolloutPlan())
+	if err != nil {
+		errorf("failed to resume the rollout: %v\n", err)
+		os.Exit(1)
+	}
+
+	if abortRollout {
+		if err := rollout.Abort(); err != nil {
+			errorf("failed to roll back the rollout: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("%s, release %s rolled back\n", config.Deployment.Id, rollout.Config.Labels["releaseId"])
+		return
+	}
+
+	runRollout(rollout)
+}
+
+// runRollout runs a rollout, printing the health of the devices of every step.
+func runRollout(rollout *releaser.Rollout) {
+	steps := len(config.Rollout.Steps)
+	releaseId := rollout.Config.Labels["releaseId"]
+
+	current, last := -1, ""
+	rollout.Progress = func(step int, h releaser.RolloutHealth) {
+		if step != current {
+			current = step
+			fmt.Printf("release %s, step %d/%d %s\n", releaseId, step+1, steps, rollout.StepName(step))
+		}
+
+		if s := h.String(); s != last {
+			last = s
+			fmt.Printf("  %s %s\n", time.Now().Format(time.TimeOnly), s)
+		}
+	}
+
+	if err := rollout.Run(); err != nil {
+		var failed *releaser.RolloutFailedError
+		if errors.As(err, &failed) {
+			errorf("%v, release %s rolled back\n", err, releaseId)
+		} else {
+			errorf("rollout interrupted: %v, use --resume to go on with it or --abort to roll it back\n", err)
+		}
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s, release %s\n", config.Deployment.Id, releaseId)
+}
@@ -1,19 +1,51 @@
 package elcli
 
 import (
+	"bytes"
+	"fmt"
 	"os"
+	"path/filepath"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/unbrikd/edge-leap/internal/configuration"
+	"github.com/unbrikd/edge-leap/internal/utils"
 )
 
-const DEFAULT_CONFIG_FILE = "./edge-leap.yaml"
+const DEFAULT_CONFIG_FILE = "./" + configuration.CONFIG_FILE_NAME
 
 var cfgFile string
 var force bool
 var config configuration.Configuration
 var envFlag []string
+var environment string
+
+// redactor hides the secret values of the configuration from the command output.
+var redactor *configuration.Redactor
+
+// moduleFlags holds the values of the module flags, which override the main module of the configuration.
+var moduleFlags configuration.Module
+
+// flagKeys holds the configuration keys overridden by the flags, by flag name.
+var flagKeys = map[string]string{
+	"id":               "deployment.id",
+	"priority":         "deployment.priority",
+	"target-condition": "deployment.target-condition",
+	"device-name":      "device.name",
+	"device":           "device.name",
+	"strategy":         "device.strategy",
+	"hub":              "infra.hub",
+	"token":            "auth.token",
+}
+
+// configOptional lets commands run without configuration file, their settings coming from the flags, the environment
+// variables and the user configuration.
+var configOptional bool
+
+// envFiles holds the dotenv files to read the main module environment variables from.
+var envFiles []string
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -21,6 +53,10 @@ var rootCmd = &cobra.Command{
 	Short: "The edge leap (el) cli is a tool to streamline the development of edge computing applications.",
 	Long: `The edge leap client (elcli) is a tool to streamline the development of edge computing applications.
 unbrikd (c) 2024`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		bindFlags(cmd.Flags())
+		return resolveConfigFile(cmd.Flags())
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -35,21 +71,261 @@ func Execute() {
 func init() {
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 
-	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", DEFAULT_CONFIG_FILE, "configuration file")
+	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", fmt.Sprintf("configuration file (default: $%s, or the nearest %s from the working directory up)", configuration.CONFIG_ENV, configuration.CONFIG_FILE_NAME))
 	rootCmd.PersistentFlags().BoolVarP(&force, "force", "f", false, "force an action")
+	// named --environment rather than --env, which sets the environment variables of the module on the deploy commands
+	rootCmd.PersistentFlags().StringVarP(&environment, "environment", "E", "", "environment of the configuration file to apply (e.g. staging), not to be confused with --env setting the module environment variables")
+
+	// every setting can be overridden by an ELCLI_ prefixed environment variable, e.g. ELCLI_AUTH_TOKEN
+	viper.SetEnvPrefix(configuration.ENV_PREFIX)
+	viper.SetEnvKeyReplacer(configuration.EnvKeyReplacer)
+	viper.AutomaticEnv()
+	for _, k := range configuration.EnvKeys() {
+		viper.BindEnv(append([]string{k}, configuration.EnvVars(k)...)...)
+	}
+}
+
+// bindFlags binds the configuration keys to the flags of the command being executed, so the flags set in the command
+// line take precedence over the environment variables and the configuration file. Binding happens once the command is
+// known since several commands define the same flags, and a key can only be bound to one flag.
+func bindFlags(flags *pflag.FlagSet) {
+	for name, key := range flagKeys {
+		if f := flags.Lookup(name); f != nil {
+			viper.BindPFlag(key, f)
+		}
+	}
+}
+
+// resolveConfigFile sets the configuration file used by the command: the --config flag, the ELCLI_CONFIG environment
+// variable, or the nearest configuration file found from the working directory up. When there is none, the
+// configuration file of the working directory is used, so draft new creates it there.
+func resolveConfigFile(flags *pflag.FlagSet) error {
+	if flags.Changed("config") {
+		return nil
+	}
+
+	if path := os.Getenv(configuration.CONFIG_ENV); path != "" {
+		cfgFile = path
+		return nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	cfgFile, err = configuration.Discover(wd)
+	if _, ok := err.(*configuration.ConfigNotFoundError); ok {
+		cfgFile = DEFAULT_CONFIG_FILE
+		return nil
+	}
+
+	return err
+}
+
+// projectPath returns a path of the configuration resolved from the project root, the directory of the configuration
+// file, so commands behave the same from any directory of the project. Absolute and empty paths are returned untouched.
+func projectPath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(filepath.Dir(cfgFile), path)
+}
+
+// readUserConfig reads the user configuration file holding the defaults of every project, nil is returned if it does
+// not exist.
+func readUserConfig() (map[string]interface{}, error) {
+	path := configuration.UserConfigFile()
+	if path == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	defaults, _, err := configuration.Decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	configuration.Normalize(defaults)
+
+	return defaults, nil
+}
+
+// readConfig reads the configuration file into a raw configuration. Configuration files written with an older schema
+// version are migrated in memory, the file itself is left untouched (see the config migrate command). The defaults of
+// the user configuration file are merged under it, the selected environment is applied onto the configuration, then
+// variables and secret references are resolved. The content of the file is returned along with it.
+func readConfig() (map[string]interface{}, []byte, error) {
+	b, err := os.ReadFile(cfgFile)
+	if os.IsNotExist(err) && configOptional {
+		b, err = nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, _, err := configuration.Decode(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	configuration.Normalize(raw)
+
+	defaults, err := readUserConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	configuration.MergeDefaults(raw, defaults)
+
+	if environment != "" {
+		if err := configuration.ApplyEnvironment(raw, environment); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	secrets, err := configuration.Resolve(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	redactor = configuration.NewRedactor(secrets)
+
+	return raw, b, nil
 }
 
+// loadConfig reads the configuration file into the configuration and validates it. Settings are taken, by order of
+// precedence, from the flags, the ELCLI_ environment variables, the configuration file and the flags defaults.
 func loadConfig() (*configuration.Configuration, error) {
+	b, err := decodeConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		if errs, ok := err.(configuration.ValidationErrors); ok {
+			errs.Locate(b, environment)
+			for i := range errs {
+				errs[i].Message = redactor.Redact(errs[i].Message)
+			}
+		}
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// decodeConfig reads the configuration file into the configuration like loadConfig, without validating it. The content
+// of the file is returned.
+func decodeConfig() ([]byte, error) {
 	viper.SetConfigFile(cfgFile)
 	viper.SetConfigType("yaml")
 
-	if err := viper.ReadInConfig(); err != nil {
+	raw, b, err := readConfig()
+	if err != nil {
 		return nil, err
 	}
 
-	if err := viper.Unmarshal(&config); err != nil {
+	migrated, err := configuration.Encode(raw)
+	if err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	if err := viper.ReadConfig(bytes.NewReader(migrated)); err != nil {
+		return nil, err
+	}
+
+	// lists and maps are emptied before decoding, so reloading the configuration does not keep removed entries
+	hook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		configuration.EnvDecodeHook,
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))
+	if err := viper.Unmarshal(&config, hook, func(dc *mapstructure.DecoderConfig) { dc.ZeroFields = true }); err != nil {
+		return nil, err
+	}
+	applyModuleEnv()
+
+	// the credentials can be set through the environment, they are not part of the secrets found in the configuration
+	// file
+	redactor.Add(config.Auth.Token)
+	for _, r := range config.Registries {
+		redactor.Add(r.Password, r.Token)
+	}
+	for _, h := range config.Infra.Hubs {
+		redactor.Add(h.Token)
+	}
+
+	return b, nil
+}
+
+// loadOptionalConfig loads the configuration like loadConfig, a missing configuration file being an empty one.
+func loadOptionalConfig() (*configuration.Configuration, error) {
+	configOptional = true
+	return loadConfig()
+}
+
+// applyModuleEnv overrides the settings of the main module with the ELCLI_MODULE_ environment variables.
+func applyModuleEnv() {
+	key := func(k string) string { return configuration.MODULE_ENV_KEY + "." + k }
+
+	if viper.IsSet(key("name")) {
+		config.MainModule().Name = viper.GetString(key("name"))
+	}
+
+	if viper.IsSet(key("startup-order")) {
+		config.MainModule().StartupOrder = viper.GetInt(key("startup-order"))
+	}
+
+	if viper.IsSet(key("create-options")) {
+		config.MainModule().CreateOptions = viper.GetString(key("create-options"))
+	}
+
+	if viper.IsSet(key("image")) {
+		config.MainModule().Image = viper.GetString(key("image"))
+	}
+}
+
+// applyModuleFlags overrides the settings of the main module with the module flags set in the command line. The
+// environment variables are merged by name, from the lowest to the highest precedence: configuration file, dotenv files
+// (in the order given, later files win) and --env flags. The configuration is validated again once the flags are
+// applied.
+func applyModuleFlags(flags *pflag.FlagSet) error {
+	m := config.MainModule()
+
+	if flags.Changed("module-name") {
+		m.Name = moduleFlags.Name
+	}
+
+	if flags.Changed("create-options") {
+		m.CreateOptions = moduleFlags.CreateOptions
+	}
+
+	if flags.Changed("startup-order") {
+		m.StartupOrder = moduleFlags.StartupOrder
+	}
+
+	if flags.Changed("image") {
+		m.Image = moduleFlags.Image
+	}
+
+	env := [][]string{m.Env}
+	for _, f := range envFiles {
+		pairs, err := utils.ReadDotEnv(f)
+		if err != nil {
+			return err
+		}
+		env = append(env, pairs)
+	}
+	m.Env = utils.MergeKeyValuePairs("=", append(env, moduleFlags.Env)...)
+
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("%s", redactor.Redact(err.Error()))
+	}
+
+	return nil
 }
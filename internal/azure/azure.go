@@ -20,6 +20,8 @@ type Client struct {
 	Configurations *ConfigurationsService
 	// Devices service for the Azure IoT Hub API.
 	Devices *DevicesService
+	// Jobs service for the Azure IoT Hub API.
+	Jobs *JobsService
 }
 
 type Response struct {
@@ -56,6 +58,7 @@ func (c *Client) initialize() {
 	}
 	c.Configurations = &ConfigurationsService{client: c, BaseURL: c.BaseURL}
 	c.Devices = &DevicesService{client: c, BaseURL: c.BaseURL}
+	c.Jobs = &JobsService{client: c, BaseURL: c.BaseURL}
 }
 
 // WithAuthToken sets the Authorization header for the client.
@@ -0,0 +1,144 @@
+package azure
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// The authentication types of the device identities.
+const (
+	AUTH_SAS                   = "sas"
+	AUTH_SELF_SIGNED           = "selfSigned"
+	AUTH_CERTIFICATE_AUTHORITY = "certificateAuthority"
+)
+
+// Device represents an Azure IoT Hub device identity. This schema is described at:
+// https://learn.microsoft.com/en-us/rest/api/iothub/service/devices/get-identity?view=rest-iothub-service-2021-11-30
+type Device struct {
+	DeviceId                   string               `json:"deviceId"`
+	ETag                       string               `json:"etag,omitempty"`
+	Status                     string               `json:"status,omitempty"`
+	StatusReason               string               `json:"statusReason,omitempty"`
+	ConnectionState            string               `json:"connectionState,omitempty"`
+	LastActivityTime           string               `json:"lastActivityTime,omitempty"`
+	CloudToDeviceMessageCount  int                  `json:"cloudToDeviceMessageCount,omitempty"`
+	Authentication             DeviceAuthentication `json:"authentication"`
+	Capabilities               DeviceCapabilities   `json:"capabilities"`
+	ConnectionStateUpdatedTime string               `json:"connectionStateUpdatedTime,omitempty"`
+}
+
+// DeviceAuthentication holds the authentication mechanism of a device identity. The hub generates the symmetric keys
+// of a sas device created without keys.
+type DeviceAuthentication struct {
+	Type           string          `json:"type"`
+	SymmetricKey   *SymmetricKey   `json:"symmetricKey,omitempty"`
+	X509Thumbprint *X509Thumbprint `json:"x509Thumbprint,omitempty"`
+}
+
+// SymmetricKey holds the shared access keys of a device identity.
+type SymmetricKey struct {
+	PrimaryKey   string `json:"primaryKey,omitempty"`
+	SecondaryKey string `json:"secondaryKey,omitempty"`
+}
+
+// X509Thumbprint holds the thumbprints of the self signed certificates of a device identity.
+type X509Thumbprint struct {
+	PrimaryThumbprint   string `json:"primaryThumbprint,omitempty"`
+	SecondaryThumbprint string `json:"secondaryThumbprint,omitempty"`
+}
+
+// DeviceCapabilities holds the capabilities of a device identity, IoTEdge is set for IoT Edge devices.
+type DeviceCapabilities struct {
+	IoTEdge bool `json:"iotEdge"`
+}
+
+// CreateDevice creates a device identity in the Azure IoT Hub. The created device is returned if the operation is
+// successful, with the keys generated by the hub.
+func (d *DevicesService) CreateDevice(device Device) (*Device, *Response, error) {
+	u := fmt.Sprintf("devices/%s?api-version=2021-04-12", url.PathEscape(device.DeviceId))
+
+	req, err := d.client.NewRequest("PUT", u, device)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dNew := new(Device)
+	res, err := d.client.Do(req, dNew)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dNew, &Response{res}, nil
+}
+
+// GetDevice retrieves a device identity from the Azure IoT Hub, with its keys.
+func (d *DevicesService) GetDevice(deviceId string) (*Device, *Response, error) {
+	u := fmt.Sprintf("devices/%s?api-version=2021-04-12", url.PathEscape(deviceId))
+
+	req, err := d.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	device := new(Device)
+	res, err := d.client.Do(req, device)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return device, &Response{res}, nil
+}
+
+// ListDevices retrieves the device identities of the Azure IoT Hub, at most top of them (1000 at most).
+func (d *DevicesService) ListDevices(top int) ([]Device, *Response, error) {
+	u := fmt.Sprintf("devices?top=%d&api-version=2021-04-12", top)
+
+	req, err := d.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	devices := []Device{}
+	res, err := d.client.Do(req, &devices)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return devices, &Response{res}, nil
+}
+
+// DeleteDevice deletes a device identity from the Azure IoT Hub, whatever its ETag.
+func (d *DevicesService) DeleteDevice(deviceId string) (*Response, error) {
+	u := fmt.Sprintf("devices/%s?api-version=2021-04-12", url.PathEscape(deviceId))
+
+	req, err := d.client.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("If-Match", "*")
+
+	res, err := d.client.Do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{res}, nil
+}
+
+// ConnectionString returns the connection string of a device identity for the given hub host name (e.g.
+// my-hub.azure-devices.net), the one the device runtime is provisioned with. Devices authenticated with certificates
+// get an x509 connection string, their certificate being configured separately.
+func (device *Device) ConnectionString(hostName string) string {
+	parts := []string{"HostName=" + hostName, "DeviceId=" + device.DeviceId}
+
+	switch {
+	case device.Authentication.Type != AUTH_SAS:
+		parts = append(parts, "x509=true")
+	case device.Authentication.SymmetricKey != nil:
+		parts = append(parts, "SharedAccessKey="+device.Authentication.SymmetricKey.PrimaryKey)
+	}
+
+	return strings.Join(parts, ";")
+}
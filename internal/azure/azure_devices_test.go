@@ -0,0 +1,96 @@
+package azure_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+// newDevicesClient returns a client of a hub stand-in holding device identities, generating the keys of sas devices.
+func newDevicesClient(t *testing.T) *azure.Client {
+	devices := map[string]azure.Device{}
+
+	return newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/devices/")
+		switch {
+		case r.URL.Path == "/devices" && r.Method == http.MethodGet:
+			list := []azure.Device{}
+			for _, d := range devices {
+				list = append(list, d)
+			}
+			json.NewEncoder(w).Encode(list)
+		case r.Method == http.MethodPut:
+			d := azure.Device{}
+			json.NewDecoder(r.Body).Decode(&d)
+			if d.Authentication.Type == azure.AUTH_SAS && d.Authentication.SymmetricKey == nil {
+				d.Authentication.SymmetricKey = &azure.SymmetricKey{PrimaryKey: "primary==", SecondaryKey: "secondary=="}
+			}
+			devices[id] = d
+			json.NewEncoder(w).Encode(d)
+		case r.Method == http.MethodGet:
+			d, ok := devices[id]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(d)
+		case r.Method == http.MethodDelete:
+			if r.Header.Get("If-Match") != "*" {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			delete(devices, id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+}
+
+func TestDevices(t *testing.T) {
+	c := newDevicesClient(t)
+
+	d, res, err := c.Devices.CreateDevice(azure.Device{
+		DeviceId:       "lab-gw-01",
+		Authentication: azure.DeviceAuthentication{Type: azure.AUTH_SAS},
+		Capabilities:   azure.DeviceCapabilities{IoTEdge: true},
+	})
+	if err != nil || res.Expect(http.StatusOK) != nil {
+		t.Fatalf("failed to create the device: %v", err)
+	}
+
+	expected := "HostName=my-hub.azure-devices.net;DeviceId=lab-gw-01;SharedAccessKey=primary=="
+	if cs := d.ConnectionString("my-hub.azure-devices.net"); cs != expected {
+		t.Errorf("expected %s, got %s", expected, cs)
+	}
+
+	if _, _, err := c.Devices.CreateDevice(azure.Device{
+		DeviceId:       "lab-gw-02",
+		Authentication: azure.DeviceAuthentication{Type: azure.AUTH_SELF_SIGNED, X509Thumbprint: &azure.X509Thumbprint{PrimaryThumbprint: "ABCD"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	d, res, err = c.Devices.GetDevice("lab-gw-02")
+	if err != nil || res.Expect(http.StatusOK) != nil {
+		t.Fatalf("failed to get the device: %v", err)
+	}
+
+	if cs := d.ConnectionString("my-hub.azure-devices.net"); !strings.HasSuffix(cs, ";x509=true") {
+		t.Errorf("expected an x509 connection string, got %s", cs)
+	}
+
+	devices, _, err := c.Devices.ListDevices(100)
+	if err != nil || len(devices) != 2 {
+		t.Fatalf("expected 2 devices, got %v (%v)", devices, err)
+	}
+
+	if res, err := c.Devices.DeleteDevice("lab-gw-01"); err != nil || res.Expect(http.StatusNoContent) != nil {
+		t.Fatalf("failed to delete the device: %v", err)
+	}
+
+	if _, res, _ := c.Devices.GetDevice("lab-gw-01"); !res.Is(http.StatusNotFound) {
+		t.Error("expected the device to be deleted")
+	}
+}
@@ -2,9 +2,16 @@ package azure
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 )
 
+// DEFAULT_MODULE_VERSION is the module version set in the deployment manifest when none is provided.
+const DEFAULT_MODULE_VERSION = "1.0"
+
 type ConfigurationsService service
 type DevicesService service
 
@@ -17,16 +24,35 @@ type Configuration struct {
 	Id                 string                 `json:"id"`
 	Labels             map[string]string      `json:"labels,omitempty"`
 	LastUpdatedTimeUtc string                 `json:"lastUpdatedTimeUtc,omitempty"`
-	Metrics            interface{}            `json:"metrics,omitempty"`
+	Metrics            *ConfigurationMetrics  `json:"metrics,omitempty"`
 	Priority           int16                  `json:"priority"`
 	SchemaVersion      string                 `json:"schemaVersion,omitempty"`
-	SystemMetrics      interface{}            `json:"systemMetrics,omitempty"`
+	SystemMetrics      *ConfigurationMetrics  `json:"systemMetrics,omitempty"`
 	TargetCondition    string                 `json:"targetCondition"`
 }
 
+// ConfigurationMetrics holds the metrics of a configuration: the queries counting the devices, by metric name, and the
+// counts computed by the hub.
+type ConfigurationMetrics struct {
+	Queries map[string]string `json:"queries,omitempty"`
+	Results map[string]int64  `json:"results,omitempty"`
+}
+
 type Twin struct {
-	DeviceId string      `json:"deviceId"`
-	Tags     interface{} `json:"tags"`
+	DeviceId        string                 `json:"deviceId"`
+	ModuleId        string                 `json:"moduleId,omitempty"`
+	ETag            string                 `json:"etag,omitempty"`
+	Status          string                 `json:"status,omitempty"`
+	ConnectionState string                 `json:"connectionState,omitempty"`
+	Tags            interface{}            `json:"tags"`
+	Properties      *TwinProperties        `json:"properties,omitempty"`
+	Capabilities    map[string]interface{} `json:"capabilities,omitempty"`
+}
+
+// TwinProperties holds the desired and reported properties of a twin.
+type TwinProperties struct {
+	Desired  map[string]interface{} `json:"desired,omitempty"`
+	Reported map[string]interface{} `json:"reported,omitempty"`
 }
 
 // GetConfiguration retrieves a configuration from the Azure IoT Hub. A configuration object is returned if the operation is successful, otherwise an error is returned and the configuration object
@@ -67,6 +93,28 @@ func (s *ConfigurationsService) CreateConfiguration(ctx context.Context, c Confi
 	return cNew, &Response{res}, nil
 }
 
+// UpdateConfiguration updates the target condition, the priority, the labels and the metrics of a configuration in the
+// Azure IoT Hub, its content cannot change. The configuration must not have changed since it was read with its ETag,
+// the hub answers 412 Precondition Failed otherwise.
+func (s *ConfigurationsService) UpdateConfiguration(ctx context.Context, c Configuration) (*Configuration, *Response, error) {
+	u := fmt.Sprintf("configurations/%s?api-version=2021-04-12", c.Id)
+
+	req, err := s.client.NewRequest("PUT", u, c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.Header.Set("If-Match", fmt.Sprintf("\"%s\"", strings.Trim(c.ETag, `"`)))
+
+	cNew := new(Configuration)
+	res, err := s.client.Do(req, cNew)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cNew, &Response{res}, nil
+}
+
 // DeleteConfiguration deletes a configuration from the Azure IoT Hub. An error is returned if the operation is not successful.
 func (s *ConfigurationsService) DeleteConfiguration(id string) (*Response, error) {
 	u := fmt.Sprintf("configurations/%s?api-version=2021-04-12", id)
@@ -84,8 +132,28 @@ func (s *ConfigurationsService) DeleteConfiguration(id string) (*Response, error
 	return &Response{res}, nil
 }
 
+// ApplyConfigurationContent applies a configuration content to a single IoT Edge device, replacing its deployment
+// manifest immediately. The content must hold the whole desired properties of the $edgeAgent and $edgeHub modules, not
+// the layered properties of a configuration. An error is returned if the operation is not successful.
+func (s *ConfigurationsService) ApplyConfigurationContent(deviceId string, content map[string]interface{}) (*Response, error) {
+	u := fmt.Sprintf("devices/%s/applyConfigurationContent?api-version=2021-04-12", url.PathEscape(deviceId))
+
+	req, err := s.client.NewRequest("POST", u, content)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.Do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{res}, nil
+}
+
 // SetContent sets the content of the properties key in the a Configuration object. Since this key is dynamic (depends on the module name), we have to handle it in a special way.
 // The current supported properties to set are: module name, image URL, module create options and module startup order.
+// Calling SetContent several times with different module names adds all the modules to the configuration content.
 func (c *Configuration) SetContent(mod, img, opts string, so int, vars map[string]string) {
 	props := fmt.Sprintf("properties.desired.modules.%s", mod)
 
@@ -98,26 +166,112 @@ func (c *Configuration) SetContent(mod, img, opts string, so int, vars map[strin
 		}
 	}
 
-	contents := map[string]interface{}{
-		"modulesContent": map[string]interface{}{
-			"$edgeAgent": map[string]interface{}{
-				props: map[string]interface{}{
-					"settings": map[string]string{
-						"image":         img,
-						"createOptions": opts,
-					},
-					"startupOrder":  so,
-					"env":           env,
-					"type":          "docker",
-					"status":        "running",
-					"restartPolicy": "always",
-					"version":       "1.0",
-				},
-			},
+	c.moduleContent("$edgeAgent")[props] = map[string]interface{}{
+		"settings": map[string]string{
+			"image":         img,
+			"createOptions": opts,
 		},
+		"startupOrder":  so,
+		"env":           env,
+		"type":          "docker",
+		"status":        "running",
+		"restartPolicy": "always",
+		"version":       DEFAULT_MODULE_VERSION,
+	}
+}
+
+// SetRoutes adds edge hub routes to the configuration content, by route name.
+func (c *Configuration) SetRoutes(routes map[string]string) {
+	if len(routes) == 0 {
+		return
 	}
 
-	c.Content = contents
+	edgeHub := c.moduleContent("$edgeHub")
+	for name, route := range routes {
+		edgeHub[fmt.Sprintf("properties.desired.routes.%s", name)] = route
+	}
+}
+
+// moduleContent returns the desired properties of a module in the configuration content, creating it if needed.
+func (c *Configuration) moduleContent(mod string) map[string]interface{} {
+	if c.Content == nil {
+		c.Content = map[string]interface{}{}
+	}
+
+	modulesContent, ok := c.Content["modulesContent"].(map[string]interface{})
+	if !ok {
+		modulesContent = map[string]interface{}{}
+		c.Content["modulesContent"] = modulesContent
+	}
+
+	content, ok := modulesContent[mod].(map[string]interface{})
+	if !ok {
+		content = map[string]interface{}{}
+		modulesContent[mod] = content
+	}
+
+	return content
+}
+
+// SetModuleVersion sets the version of a module previously added with SetContent. The edge agent recreates a module
+// whenever its version changes, which allows redeploying the same image reference. Nothing is done if the module is not
+// part of the configuration content.
+func (c *Configuration) SetModuleVersion(mod, version string) {
+	modulesContent, ok := c.Content["modulesContent"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	edgeAgent, ok := modulesContent["$edgeAgent"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	props, ok := edgeAgent[fmt.Sprintf("properties.desired.modules.%s", mod)].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	props["version"] = version
+}
+
+// MergeModuleEnv sets environment variables of a module of the configuration content, the other variables of the
+// module being kept. False is returned if the module is not part of the configuration content.
+func (c *Configuration) MergeModuleEnv(mod string, vars map[string]string) bool {
+	modulesContent, _ := c.Content["modulesContent"].(map[string]interface{})
+	edgeAgent, _ := modulesContent["$edgeAgent"].(map[string]interface{})
+	props, ok := edgeAgent[fmt.Sprintf("properties.desired.modules.%s", mod)].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	env, ok := props["env"].(map[string]interface{})
+	if !ok {
+		env = map[string]interface{}{}
+		props["env"] = env
+	}
+
+	for k, v := range vars {
+		env[k] = map[string]interface{}{"value": v}
+	}
+
+	return true
+}
+
+// Tag returns the value of a twin tag given its dotted path (e.g. application.myModule). Nil is returned if the tag does
+// not exist.
+func (t *Twin) Tag(path string) interface{} {
+	var v interface{} = t.Tags
+	for _, k := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		v = m[k]
+	}
+
+	return v
 }
 
 // GetTwin retrieves the twin of a device from the Azure IoT Hub. A twin object is returned if the operation is successful, otherwise an error is returned and the twin object is nil.
@@ -141,6 +295,13 @@ func (d *DevicesService) GetTwin(deviceId string) (*Twin, *Response, error) {
 // UpdateTwinTags updates the tags of a device twin in the Azure IoT Hub. To change the tags, the structure provided must match the structure of the tags in the twin.
 // If the tag is missing in the structure, it will be created. If any tag is set to nil, it will be removed from the twin.
 func (d *DevicesService) UpdateTwinTags(deviceId string, tags map[string]interface{}) (*Twin, *Response, error) {
+	return d.UpdateTwinTagsIfMatch(deviceId, tags, "")
+}
+
+// UpdateTwinTagsIfMatch updates the tags of a device twin like UpdateTwinTags, only if the twin has not changed since it
+// was read with the given ETag. The hub answers 412 Precondition Failed otherwise. The update is unconditional when the
+// ETag is empty.
+func (d *DevicesService) UpdateTwinTagsIfMatch(deviceId string, tags map[string]interface{}, etag string) (*Twin, *Response, error) {
 	u := fmt.Sprintf("twins/%s?api-version=2021-04-12", deviceId)
 
 	req, err := d.client.NewRequest("PATCH", u, tags)
@@ -148,6 +309,10 @@ func (d *DevicesService) UpdateTwinTags(deviceId string, tags map[string]interfa
 		return nil, nil, err
 	}
 
+	if etag != "" {
+		req.Header.Set("If-Match", fmt.Sprintf("\"%s\"", strings.Trim(etag, `"`)))
+	}
+
 	tNew := new(Twin)
 	res, err := d.client.Do(req, tNew)
 	if err != nil {
@@ -156,3 +321,80 @@ func (d *DevicesService) UpdateTwinTags(deviceId string, tags map[string]interfa
 
 	return tNew, &Response{res}, nil
 }
+
+// QueryTwins returns the twins of the devices matching an IoT Hub query (e.g. SELECT * FROM devices WHERE
+// is_defined(tags.elcli)). The result pages are all fetched, following the continuation token of the hub.
+func (d *DevicesService) QueryTwins(query string) ([]Twin, *Response, error) {
+	twins := []Twin{}
+	res, err := d.query(query, func(b json.RawMessage) error {
+		page := []Twin{}
+		if err := json.Unmarshal(b, &page); err != nil {
+			return err
+		}
+
+		twins = append(twins, page...)
+		return nil
+	})
+	if err != nil || !res.Is(http.StatusOK) {
+		return nil, res, err
+	}
+
+	return twins, res, nil
+}
+
+// QueryTwinDocuments returns the twins of the devices matching an IoT Hub query like QueryTwins, as the JSON
+// documents returned by the hub, so every field of the twins is kept (e.g. modelId or lastActivityTime).
+func (d *DevicesService) QueryTwinDocuments(query string) ([]map[string]interface{}, *Response, error) {
+	docs := []map[string]interface{}{}
+	res, err := d.query(query, func(b json.RawMessage) error {
+		page := []map[string]interface{}{}
+		if err := json.Unmarshal(b, &page); err != nil {
+			return err
+		}
+
+		docs = append(docs, page...)
+		return nil
+	})
+	if err != nil || !res.Is(http.StatusOK) {
+		return nil, res, err
+	}
+
+	return docs, res, nil
+}
+
+// query runs an IoT Hub query and hands every result page to the add function, following the continuation token of
+// the hub. The response of the first page not answered 200 OK is returned.
+func (d *DevicesService) query(query string, add func(page json.RawMessage) error) (*Response, error) {
+	u := "devices/query?api-version=2021-04-12"
+
+	continuation := ""
+	for {
+		req, err := d.client.NewRequest("POST", u, map[string]string{"query": query})
+		if err != nil {
+			return nil, err
+		}
+
+		if continuation != "" {
+			req.Header.Set("x-ms-continuation", continuation)
+		}
+
+		page := json.RawMessage{}
+		res, err := d.client.Do(req, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		r := &Response{res}
+		if !r.Is(http.StatusOK) {
+			return r, nil
+		}
+
+		if err := add(page); err != nil {
+			return nil, err
+		}
+
+		if continuation = res.Header.Get("x-ms-continuation"); continuation == "" {
+			return r, nil
+		}
+	}
+}
@@ -1,12 +1,26 @@
 package azure_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/unbrikd/edge-leap/internal/azure"
 )
 
+// newTestClient returns a client of an IoT Hub stand-in served by the handler for the duration of the test.
+func newTestClient(t *testing.T, h http.Handler) *azure.Client {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c := azure.NewClient(nil)
+	c.BaseURL, _ = url.Parse(srv.URL + "/")
+	return c
+}
+
 func TestSetContent(t *testing.T) {
 	c := azure.Configuration{}
 	moduleName := "myModule"
@@ -92,3 +106,59 @@ func TestSetContent(t *testing.T) {
 		t.Fatal("configuration module properties is missing 'version' key")
 	}
 }
+
+func TestMergeModuleEnv(t *testing.T) {
+	src := azure.Configuration{}
+	src.SetContent("myModule", "img", "", 0, map[string]string{"LOG_LEVEL": "debug", "REGION": "eu"})
+
+	// the content of the configurations read from the hub is made of generic values
+	b, _ := json.Marshal(src)
+	c := azure.Configuration{}
+	if err := json.Unmarshal(b, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.MergeModuleEnv("otherModule", map[string]string{"LOG_LEVEL": "info"}) {
+		t.Error("expected merging the env of a missing module to fail")
+	}
+
+	if !c.MergeModuleEnv("myModule", map[string]string{"LOG_LEVEL": "info"}) {
+		t.Fatal("expected the env of the module to be merged")
+	}
+
+	b, _ = json.Marshal(c.Content["modulesContent"].(map[string]interface{})["$edgeAgent"].(map[string]interface{})["properties.desired.modules.myModule"].(map[string]interface{})["env"])
+	if expected := `{"LOG_LEVEL":{"value":"info"},"REGION":{"value":"eu"}}`; string(b) != expected {
+		t.Errorf("expected %s, got %s", expected, b)
+	}
+}
+
+func TestQueryTwins(t *testing.T) {
+	pages := [][]map[string]interface{}{
+		{{"deviceId": "dev1", "modelId": "dtmi:my:device;1", "lastActivityTime": "2024-05-01T10:00:00Z", "tags": map[string]interface{}{"ring": "canary"}}},
+		{{"deviceId": "dev2", "version": 4.0}},
+	}
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := 0
+		if r.Header.Get("x-ms-continuation") == "next" {
+			page = 1
+		} else {
+			w.Header().Set("x-ms-continuation", "next")
+		}
+		json.NewEncoder(w).Encode(pages[page])
+	}))
+
+	twins, _, err := c.Devices.QueryTwins("SELECT * FROM devices")
+	if err != nil || len(twins) != 2 || twins[0].DeviceId != "dev1" || twins[1].DeviceId != "dev2" {
+		t.Fatalf("expected the twins of every page, got %v (%v)", twins, err)
+	}
+
+	docs, _, err := c.Devices.QueryTwinDocuments("SELECT * FROM devices")
+	if err != nil || len(docs) != 2 {
+		t.Fatalf("expected the documents of every page, got %v (%v)", docs, err)
+	}
+
+	if docs[0]["modelId"] != "dtmi:my:device;1" || docs[0]["lastActivityTime"] != "2024-05-01T10:00:00Z" || docs[1]["version"] != 4.0 {
+		t.Errorf("expected the documents to keep every field, got %v", docs)
+	}
+}
@@ -0,0 +1,119 @@
+package azure
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+type JobsService service
+
+// Types of the IoT Hub jobs.
+const (
+	JOB_UPDATE_TWIN   = "scheduleUpdateTwin"
+	JOB_DEVICE_METHOD = "scheduleDeviceMethod"
+)
+
+// Statuses of the IoT Hub jobs.
+const (
+	JOB_STATUS_QUEUED    = "queued"
+	JOB_STATUS_SCHEDULED = "scheduled"
+	JOB_STATUS_RUNNING   = "running"
+	JOB_STATUS_COMPLETED = "completed"
+	JOB_STATUS_FAILED    = "failed"
+	JOB_STATUS_CANCELLED = "cancelled"
+)
+
+// Job represents an Azure IoT Hub job, updating the twins or invoking a direct method of the devices matching a query
+// condition. This schema is described at:
+// https://learn.microsoft.com/en-us/rest/api/iothub/service/jobs/create-scheduled-job?view=rest-iothub-service-2021-11-30
+type Job struct {
+	JobId                     string               `json:"jobId"`
+	Type                      string               `json:"type"`
+	QueryCondition            string               `json:"queryCondition,omitempty"`
+	StartTime                 *time.Time           `json:"startTime,omitempty"`
+	EndTime                   *time.Time           `json:"endTime,omitempty"`
+	MaxExecutionTimeInSeconds int                  `json:"maxExecutionTimeInSeconds,omitempty"`
+	UpdateTwin                *TwinPatch           `json:"updateTwin,omitempty"`
+	CloudToDeviceMethod       *MethodInvocation    `json:"cloudToDeviceMethod,omitempty"`
+	Status                    string               `json:"status,omitempty"`
+	FailureReason             string               `json:"failureReason,omitempty"`
+	StatusMessage             string               `json:"statusMessage,omitempty"`
+	DeviceJobStatistics       *JobDeviceStatistics `json:"deviceJobStatistics,omitempty"`
+}
+
+// TwinPatch is the update of the twins applied by a job, the tags and the desired properties are merged into the twins.
+type TwinPatch struct {
+	ETag       string          `json:"etag"`
+	Tags       interface{}     `json:"tags,omitempty"`
+	Properties *TwinProperties `json:"properties,omitempty"`
+}
+
+// JobDeviceStatistics counts the devices of a job by status.
+type JobDeviceStatistics struct {
+	DeviceCount    int `json:"deviceCount"`
+	FailedCount    int `json:"failedCount"`
+	SucceededCount int `json:"succeededCount"`
+	RunningCount   int `json:"runningCount"`
+	PendingCount   int `json:"pendingCount"`
+}
+
+// NewTwinUpdateJob returns a job merging tags into the twins of the devices matching a query condition, started now.
+func NewTwinUpdateJob(id, condition string, tags map[string]interface{}) Job {
+	now := time.Now().UTC()
+	return Job{
+		JobId:          id,
+		Type:           JOB_UPDATE_TWIN,
+		QueryCondition: condition,
+		StartTime:      &now,
+		UpdateTwin:     &TwinPatch{ETag: "*", Tags: tags},
+	}
+}
+
+// NewDeviceMethodJob returns a job invoking a direct method on the devices matching a query condition, started now.
+func NewDeviceMethodJob(id, condition string, m MethodInvocation) Job {
+	now := time.Now().UTC()
+	return Job{
+		JobId:               id,
+		Type:                JOB_DEVICE_METHOD,
+		QueryCondition:      condition,
+		StartTime:           &now,
+		CloudToDeviceMethod: &m,
+	}
+}
+
+// Done reports whether the job is over, completed, failed or cancelled.
+func (j *Job) Done() bool {
+	return j.Status == JOB_STATUS_COMPLETED || j.Status == JOB_STATUS_FAILED || j.Status == JOB_STATUS_CANCELLED
+}
+
+// ScheduleJob schedules a job in the Azure IoT Hub. The job object is returned with its status if the operation is
+// successful, otherwise an error is returned and the job object is nil.
+func (s *JobsService) ScheduleJob(j Job) (*Job, *Response, error) {
+	return s.do("PUT", fmt.Sprintf("jobs/v2/%s?api-version=2021-04-12", url.PathEscape(j.JobId)), j)
+}
+
+// GetJob retrieves a job, and its status, from the Azure IoT Hub.
+func (s *JobsService) GetJob(id string) (*Job, *Response, error) {
+	return s.do("GET", fmt.Sprintf("jobs/v2/%s?api-version=2021-04-12", url.PathEscape(id)), nil)
+}
+
+// CancelJob cancels a job of the Azure IoT Hub, the devices already updated are left untouched.
+func (s *JobsService) CancelJob(id string) (*Job, *Response, error) {
+	return s.do("POST", fmt.Sprintf("jobs/v2/%s/cancel?api-version=2021-04-12", url.PathEscape(id)), nil)
+}
+
+func (s *JobsService) do(method, u string, body interface{}) (*Job, *Response, error) {
+	req, err := s.client.NewRequest(method, u, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	j := new(Job)
+	res, err := s.client.Do(req, j)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return j, &Response{res}, nil
+}
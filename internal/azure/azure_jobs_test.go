@@ -0,0 +1,50 @@
+package azure_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+func TestJobs(t *testing.T) {
+	requests := []string{}
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		j := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&j)
+		j["jobId"] = "tag-ring"
+		j["status"] = azure.JOB_STATUS_QUEUED
+		if r.Method == http.MethodPost {
+			j["status"] = azure.JOB_STATUS_CANCELLED
+		}
+		json.NewEncoder(w).Encode(j)
+	}))
+
+	job, _, err := c.Jobs.ScheduleJob(azure.NewTwinUpdateJob("tag-ring", "tags.environment='dev'", map[string]interface{}{"ring": "canary"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Done() || job.UpdateTwin == nil || job.UpdateTwin.Tags.(map[string]interface{})["ring"] != "canary" {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	if _, _, err := c.Jobs.GetJob("tag-ring"); err != nil {
+		t.Fatal(err)
+	}
+
+	job, _, err = c.Jobs.CancelJob("tag-ring")
+	if err != nil || !job.Done() {
+		t.Fatalf("expected the job to be cancelled, got %v", err)
+	}
+
+	expected := []string{"PUT /jobs/v2/tag-ring", "GET /jobs/v2/tag-ring", "POST /jobs/v2/tag-ring/cancel"}
+	for i, r := range expected {
+		if i >= len(requests) || requests[i] != r {
+			t.Errorf("expected request %s, got %v", r, requests)
+		}
+	}
+}
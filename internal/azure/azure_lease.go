@@ -0,0 +1,63 @@
+package azure
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// LEASE_TAG is the dotted path of the device twin tag holding the lease of the device.
+const LEASE_TAG = "elcli.lease"
+
+// Lease is the lock a developer holds on a device while drafting on it. It is stored in the device twin tags, so every
+// client sharing the hub sees who is using the device, and expires unless renewed.
+type Lease struct {
+	// Owner identifies the developer holding the lease (e.g. user@host).
+	Owner string `json:"owner"`
+	// Session is the draft session holding the lease.
+	Session string `json:"session"`
+	// Module is the main module of the draft session.
+	Module string `json:"module,omitempty"`
+	// ExpiresAt is the time the lease expires at, unless renewed.
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Expired reports whether the lease has expired at the given time.
+func (l *Lease) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// Lease returns the lease held on the device, nil if the device is not leased.
+func (t *Twin) Lease() (*Lease, error) {
+	v := t.Tag(LEASE_TAG)
+	if v == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	l := new(Lease)
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// LeaseTags returns the tags patch setting the lease of a device, a nil lease removes it.
+func LeaseTags(l *Lease) map[string]interface{} {
+	var lease interface{}
+	if l != nil {
+		lease = l
+	}
+
+	return map[string]interface{}{
+		"tags": map[string]interface{}{
+			"elcli": map[string]interface{}{
+				"lease": lease,
+			},
+		},
+	}
+}
@@ -0,0 +1,115 @@
+package azure
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// LOG_LEVELS are the names of the syslog severity levels of the module logs, from 0 (emergency) to 7 (debug).
+var LOG_LEVELS = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// LogsFilter selects the lines of the module logs returned by the edge agent. Since and Until are durations (e.g. 10m),
+// RFC3339 timestamps or UNIX timestamps, Regex filters the text of the lines, and Tail the number of lines from the end
+// of the logs. The zero values do not filter.
+type LogsFilter struct {
+	Since string `json:"since,omitempty"`
+	Until string `json:"until,omitempty"`
+	Tail  int    `json:"tail,omitempty"`
+	Regex string `json:"regex,omitempty"`
+}
+
+// LogMessage is a line of the logs of a module, as reported by the edge agent.
+type LogMessage struct {
+	ModuleId  string    `json:"moduleId"`
+	Stream    string    `json:"stream"`
+	LogLevel  int       `json:"logLevel"`
+	Text      string    `json:"text"`
+	Timestamp time.Time `json:"timeStamp"`
+}
+
+// Severity returns the name of the syslog severity level of the line.
+func (m *LogMessage) Severity() string {
+	if m.LogLevel < 0 || m.LogLevel >= len(LOG_LEVELS) {
+		return fmt.Sprint(m.LogLevel)
+	}
+
+	return LOG_LEVELS[m.LogLevel]
+}
+
+// GetModuleLogs fetches the logs of a module of an IoT Edge device through the GetModuleLogs method of the edge agent.
+// The logs are requested gzipped, in JSON, and decoded. An error is returned when the edge agent fails the method,
+// the response being checked like the others when the hub fails the invocation.
+func (d *DevicesService) GetModuleLogs(deviceId, module string, filter LogsFilter, responseTimeout time.Duration) ([]LogMessage, *Response, error) {
+	payload := map[string]interface{}{
+		"schemaVersion": "1.0",
+		"items": []map[string]interface{}{
+			{"id": fmt.Sprintf("^%s$", regexp.QuoteMeta(module)), "filter": filter},
+		},
+		"encoding":    "gzip",
+		"contentType": "json",
+	}
+
+	result, res, err := d.InvokeModuleMethod(deviceId, EDGE_AGENT, NewMethodInvocation("GetModuleLogs", payload, 0, responseTimeout))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !res.Is(http.StatusOK) {
+		return nil, res, nil
+	}
+
+	if result.Status < 200 || result.Status > 299 {
+		return nil, res, fmt.Errorf("the edge agent answered %d %s", result.Status, string(result.Payload))
+	}
+
+	items := []struct {
+		Id           string `json:"id"`
+		PayloadBytes []byte `json:"payloadBytes"`
+	}{}
+	if err := json.Unmarshal(result.Payload, &items); err != nil {
+		return nil, res, fmt.Errorf("invalid logs payload: %v", err)
+	}
+
+	messages := []LogMessage{}
+	for _, item := range items {
+		m, err := decodeLogs(item.PayloadBytes)
+		if err != nil {
+			return nil, res, fmt.Errorf("invalid logs of module '%s': %v", item.Id, err)
+		}
+
+		messages = append(messages, m...)
+	}
+
+	return messages, res, nil
+}
+
+// decodeLogs decodes gzipped JSON log lines.
+func decodeLogs(b []byte) ([]LogMessage, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []LogMessage{}
+	if err := json.Unmarshal(raw, &messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
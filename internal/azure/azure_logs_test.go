@@ -0,0 +1,72 @@
+package azure_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+func TestGetModuleLogs(t *testing.T) {
+	var invocation struct {
+		MethodName string `json:"methodName"`
+		Payload    struct {
+			Items []struct {
+				Id     string           `json:"id"`
+				Filter azure.LogsFilter `json:"filter"`
+			} `json:"items"`
+			Encoding string `json:"encoding"`
+		} `json:"payload"`
+	}
+
+	var logs bytes.Buffer
+	zw := gzip.NewWriter(&logs)
+	zw.Write([]byte(`[{"moduleId":"myModule","stream":"stdout","logLevel":3,"text":"boom","timeStamp":"2024-06-12T13:04:05.1234567Z"}]`))
+	zw.Close()
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&invocation)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  200,
+			"payload": []map[string]interface{}{{"id": "myModule", "payloadBytes": logs.Bytes()}},
+		})
+	}))
+
+	messages, res, err := c.Devices.GetModuleLogs("dev", "myModule", azure.LogsFilter{Since: "10m", Tail: 5, Regex: "boom"}, time.Minute)
+	if err == nil {
+		err = res.Expect(http.StatusOK)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if invocation.MethodName != "GetModuleLogs" || invocation.Payload.Encoding != "gzip" || len(invocation.Payload.Items) != 1 {
+		t.Fatalf("unexpected invocation %+v", invocation)
+	}
+
+	if item := invocation.Payload.Items[0]; item.Id != "^myModule$" || item.Filter.Since != "10m" || item.Filter.Tail != 5 || item.Filter.Regex != "boom" {
+		t.Errorf("unexpected logs item %+v", item)
+	}
+
+	if len(messages) != 1 || messages[0].Text != "boom" || messages[0].Severity() != "err" {
+		t.Fatalf("unexpected messages %+v", messages)
+	}
+
+	if ts := messages[0].Timestamp; !ts.Equal(time.Date(2024, 6, 12, 13, 4, 5, 123456700, time.UTC)) {
+		t.Errorf("unexpected timestamp %s", ts)
+	}
+}
+
+func TestGetModuleLogsMethodFailure(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": 400, "payload": map[string]string{"message": "invalid since"}})
+	}))
+
+	if _, _, err := c.Devices.GetModuleLogs("dev", "myModule", azure.LogsFilter{Since: "x"}, time.Minute); err == nil {
+		t.Fatal("expected an error when the edge agent fails the method")
+	}
+}
@@ -0,0 +1,72 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// EDGE_AGENT is the id of the edge agent module, which implements the built-in direct methods of IoT Edge devices
+// (ping, RestartModule, GetModuleLogs, ...).
+const EDGE_AGENT = "$edgeAgent"
+
+// EDGE_HUB is the id of the edge hub module, whose desired properties hold the routes of IoT Edge devices.
+const EDGE_HUB = "$edgeHub"
+
+// MethodInvocation is the invocation of a direct method. The connect timeout is the time the hub waits for the device
+// to connect, the response timeout the time it waits for the method result.
+type MethodInvocation struct {
+	MethodName               string      `json:"methodName"`
+	Payload                  interface{} `json:"payload"`
+	ResponseTimeoutInSeconds int         `json:"responseTimeoutInSeconds,omitempty"`
+	ConnectTimeoutInSeconds  int         `json:"connectTimeoutInSeconds,omitempty"`
+}
+
+// MethodResult is the result of a direct method, the status and the payload returned by the method.
+type MethodResult struct {
+	Status  int             `json:"status"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// NewMethodInvocation returns the invocation of a direct method with a payload and timeouts, rounded to the second. The
+// hub defaults apply to the zero timeouts.
+func NewMethodInvocation(name string, payload interface{}, connectTimeout, responseTimeout time.Duration) MethodInvocation {
+	return MethodInvocation{
+		MethodName:               name,
+		Payload:                  payload,
+		ConnectTimeoutInSeconds:  int(connectTimeout.Round(time.Second).Seconds()),
+		ResponseTimeoutInSeconds: int(responseTimeout.Round(time.Second).Seconds()),
+	}
+}
+
+// InvokeDeviceMethod invokes a direct method on a device.
+func (d *DevicesService) InvokeDeviceMethod(deviceId string, m MethodInvocation) (*MethodResult, *Response, error) {
+	return d.invokeMethod(fmt.Sprintf("twins/%s/methods?api-version=2021-04-12", url.PathEscape(deviceId)), m)
+}
+
+// InvokeModuleMethod invokes a direct method on a module of a device, e.g. a built-in method of $edgeAgent.
+func (d *DevicesService) InvokeModuleMethod(deviceId, moduleId string, m MethodInvocation) (*MethodResult, *Response, error) {
+	return d.invokeMethod(fmt.Sprintf("twins/%s/modules/%s/methods?api-version=2021-04-12", url.PathEscape(deviceId), url.PathEscape(moduleId)), m)
+}
+
+// RestartModule restarts a module of an IoT Edge device through the RestartModule method of the edge agent.
+func (d *DevicesService) RestartModule(deviceId, module string, responseTimeout time.Duration) (*MethodResult, *Response, error) {
+	payload := map[string]string{"schemaVersion": "1.0", "id": module}
+	return d.InvokeModuleMethod(deviceId, EDGE_AGENT, NewMethodInvocation("RestartModule", payload, 0, responseTimeout))
+}
+
+func (d *DevicesService) invokeMethod(u string, m MethodInvocation) (*MethodResult, *Response, error) {
+	req, err := d.client.NewRequest("POST", u, m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := new(MethodResult)
+	res, err := d.client.Do(req, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return r, &Response{res}, nil
+}
@@ -0,0 +1,41 @@
+package azure_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+func TestRestartModule(t *testing.T) {
+	var invocation azure.MethodInvocation
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/twins/dev/modules/$edgeAgent/methods" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		json.NewDecoder(r.Body).Decode(&invocation)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": 200, "payload": nil})
+	}))
+
+	result, res, err := c.Devices.RestartModule("dev", "myModule", 1500*time.Millisecond)
+	if err != nil || res.Expect(http.StatusOK) != nil {
+		t.Fatalf("failed to restart the module: %v", err)
+	}
+
+	if result.Status != 200 {
+		t.Errorf("expected the method to succeed, got %d", result.Status)
+	}
+
+	if invocation.MethodName != "RestartModule" || invocation.ResponseTimeoutInSeconds != 2 || invocation.ConnectTimeoutInSeconds != 0 {
+		t.Errorf("unexpected invocation %+v", invocation)
+	}
+
+	if payload := invocation.Payload.(map[string]interface{}); payload["id"] != "myModule" || payload["schemaVersion"] != "1.0" {
+		t.Errorf("unexpected payload %v", payload)
+	}
+}
@@ -0,0 +1,103 @@
+package azure
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Module represents an Azure IoT Hub module identity. This schema is described at:
+// https://learn.microsoft.com/en-us/rest/api/iothub/service/modules/get-identity?view=rest-iothub-service-2021-11-30
+type Module struct {
+	ModuleId         string `json:"moduleId"`
+	DeviceId         string `json:"deviceId"`
+	ManagedBy        string `json:"managedBy,omitempty"`
+	GenerationId     string `json:"generationId,omitempty"`
+	ETag             string `json:"etag,omitempty"`
+	ConnectionState  string `json:"connectionState,omitempty"`
+	LastActivityTime string `json:"lastActivityTime,omitempty"`
+}
+
+// ListModules retrieves the module identities of a device from the Azure IoT Hub.
+func (d *DevicesService) ListModules(deviceId string) ([]Module, *Response, error) {
+	u := fmt.Sprintf("devices/%s/modules?api-version=2021-04-12", url.PathEscape(deviceId))
+
+	req, err := d.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	modules := []Module{}
+	res, err := d.client.Do(req, &modules)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return modules, &Response{res}, nil
+}
+
+// GetModuleTwin retrieves the twin of a module of a device from the Azure IoT Hub, e.g. $edgeAgent.
+func (d *DevicesService) GetModuleTwin(deviceId, moduleId string) (*Twin, *Response, error) {
+	req, err := d.client.NewRequest("GET", moduleTwinPath(deviceId, moduleId), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t := new(Twin)
+	res, err := d.client.Do(req, t)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return t, &Response{res}, nil
+}
+
+// GetModuleTwinDocument retrieves the twin of a module like GetModuleTwin, as the JSON document returned by the hub, so
+// every field of the twin is kept.
+func (d *DevicesService) GetModuleTwinDocument(deviceId, moduleId string) (map[string]interface{}, *Response, error) {
+	req, err := d.client.NewRequest("GET", moduleTwinPath(deviceId, moduleId), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc := map[string]interface{}{}
+	res, err := d.client.Do(req, &doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return doc, &Response{res}, nil
+}
+
+// UpdateModuleDesired updates the desired properties of a module twin in the Azure IoT Hub. Like the tags of
+// UpdateTwinTags, missing properties are created and properties set to nil are removed. The update is unconditional
+// when the ETag is empty, otherwise the hub answers 412 Precondition Failed if the twin changed since it was read.
+func (d *DevicesService) UpdateModuleDesired(deviceId, moduleId string, desired map[string]interface{}, etag string) (*Twin, *Response, error) {
+	patch := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"desired": desired,
+		},
+	}
+
+	req, err := d.client.NewRequest("PATCH", moduleTwinPath(deviceId, moduleId), patch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if etag != "" {
+		req.Header.Set("If-Match", fmt.Sprintf("\"%s\"", strings.Trim(etag, `"`)))
+	}
+
+	t := new(Twin)
+	res, err := d.client.Do(req, t)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return t, &Response{res}, nil
+}
+
+// moduleTwinPath returns the path of the twin of a module.
+func moduleTwinPath(deviceId, moduleId string) string {
+	return fmt.Sprintf("twins/%s/modules/%s?api-version=2021-04-12", url.PathEscape(deviceId), url.PathEscape(moduleId))
+}
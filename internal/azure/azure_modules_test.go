@@ -0,0 +1,60 @@
+package azure_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+func TestModuleTwin(t *testing.T) {
+	desired := map[string]interface{}{"interval": 10.0}
+	patches := []map[string]interface{}{}
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/devices/dev/modules":
+			json.NewEncoder(w).Encode([]azure.Module{{ModuleId: "$edgeAgent", DeviceId: "dev"}, {ModuleId: "myModule", DeviceId: "dev"}})
+		case r.URL.Path == "/twins/dev/modules/myModule":
+			if r.Method == http.MethodPatch {
+				patch := map[string]interface{}{}
+				json.NewDecoder(r.Body).Decode(&patch)
+				patches = append(patches, patch)
+				for k, v := range patch["properties"].(map[string]interface{})["desired"].(map[string]interface{}) {
+					desired[k] = v
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"deviceId": "dev", "moduleId": "myModule", "modelId": "dtmi:my:module;1", "properties": map[string]interface{}{"desired": desired}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	modules, res, err := c.Devices.ListModules("dev")
+	if err != nil || res.Expect(http.StatusOK) != nil || len(modules) != 2 || modules[1].ModuleId != "myModule" {
+		t.Fatalf("expected the modules of the device, got %v (%v)", modules, err)
+	}
+
+	twin, _, err := c.Devices.UpdateModuleDesired("dev", "myModule", map[string]interface{}{"logLevel": "debug"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if twin.ModuleId != "myModule" || twin.Properties.Desired["logLevel"] != "debug" || twin.Properties.Desired["interval"] != 10.0 {
+		t.Errorf("expected the desired properties to be patched, got %v", twin.Properties)
+	}
+
+	if len(patches) != 1 {
+		t.Errorf("expected a single patch, got %v", patches)
+	}
+
+	doc, _, err := c.Devices.GetModuleTwinDocument("dev", "myModule")
+	if err != nil || doc["modelId"] != "dtmi:my:module;1" {
+		t.Errorf("expected the twin document to keep every field, got %v (%v)", doc, err)
+	}
+
+	if _, res, _ := c.Devices.GetModuleTwin("dev", "otherModule"); !res.Is(http.StatusNotFound) {
+		t.Error("expected a missing module twin not to be found")
+	}
+}
@@ -0,0 +1,46 @@
+package azure
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ROLLOUT_TAG is the dotted path of the device twin tag holding the releases rolled out to the device, by deployment.
+// Rollouts to a percentage of the devices tag the devices they have selected, so their deployment can target them.
+const ROLLOUT_TAG = "elcli.rollouts"
+
+// RolloutKey returns the key of a deployment under the rollout tag. The query language reads a dash as a minus, so the
+// characters other than letters and digits are written as '_' followed by their hexadecimal code (e.g. my-module is
+// my_2dmodule), which keeps the keys of different deployments apart.
+func RolloutKey(deploymentId string) string {
+	var b strings.Builder
+	for _, c := range []byte(deploymentId) {
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+			continue
+		}
+
+		fmt.Fprintf(&b, "_%02x", c)
+	}
+
+	return b.String()
+}
+
+// RolloutTags returns the tags patch setting the release rolled out to a device for a deployment, an empty release id
+// removes it.
+func RolloutTags(deploymentId, releaseId string) map[string]interface{} {
+	var release interface{}
+	if releaseId != "" {
+		release = releaseId
+	}
+
+	return map[string]interface{}{
+		"tags": map[string]interface{}{
+			"elcli": map[string]interface{}{
+				"rollouts": map[string]interface{}{
+					RolloutKey(deploymentId): release,
+				},
+			},
+		},
+	}
+}
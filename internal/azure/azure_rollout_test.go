@@ -0,0 +1,21 @@
+package azure_test
+
+import (
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+func TestRolloutKey(t *testing.T) {
+	tests := map[string]string{
+		"my-module": "my_2dmodule",
+		"my_module": "my_5fmodule",
+		"myModule2": "myModule2",
+	}
+
+	for id, expected := range tests {
+		if key := azure.RolloutKey(id); key != expected {
+			t.Errorf("expected the key of %s to be %s, got %s", id, expected, key)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// DEFAULT_TAG_TEMPLATE is the tag template used when none is configured.
+const DEFAULT_TAG_TEMPLATE = "{{ .Session }}"
+
+// DockerBuilder is the handler for building module images with a Docker/BuildKit compatible endpoint and pushing them
+// to a registry. The docker CLI with the buildx plugin is used, so any endpoint it can talk to is supported.
+type DockerBuilder struct {
+	// Endpoint is the docker daemon to build with (e.g. unix:///var/run/docker.sock or tcp://localhost:2375), the
+	// docker CLI default is used when empty.
+	Endpoint string
+	// Builder is the name of the buildx builder instance to use, the current one is used when empty.
+	Builder string
+}
+
+// BuildOptions holds the parameters of an image build.
+type BuildOptions struct {
+	// Context is the path of the build context.
+	Context string
+	// Dockerfile is the path of the Dockerfile, relative paths are resolved from the working directory.
+	Dockerfile string
+	// Platforms is the list of target platforms (e.g. linux/arm64), the endpoint platform is used when empty.
+	Platforms []string
+	// Image is the full image reference (including the tag) to push.
+	Image string
+}
+
+// TagData is the data available to the tag template.
+type TagData struct {
+	// Session is the draft session id.
+	Session string
+	// Version is the module version of the deployment.
+	Version string
+}
+
+func Docker(endpoint, builder string) *DockerBuilder {
+	return &DockerBuilder{
+		Endpoint: endpoint,
+		Builder:  builder,
+	}
+}
+
+// BuildAndPush builds the image described by the options, pushes it to its registry and returns the digest of the
+// pushed image (e.g. sha256:...). When building for several platforms the digest is the one of the manifest list.
+func (d *DockerBuilder) BuildAndPush(o BuildOptions) (string, error) {
+	metadata, err := os.CreateTemp("", "elcli-build-*.json")
+	if err != nil {
+		return "", err
+	}
+	metadata.Close()
+	defer os.Remove(metadata.Name())
+
+	args := []string{"buildx", "build", "--push", "--tag", o.Image, "--metadata-file", metadata.Name()}
+	if d.Builder != "" {
+		args = append(args, "--builder", d.Builder)
+	}
+
+	if o.Dockerfile != "" {
+		args = append(args, "--file", o.Dockerfile)
+	}
+
+	if len(o.Platforms) > 0 {
+		args = append(args, "--platform", strings.Join(o.Platforms, ","))
+	}
+
+	buildContext := o.Context
+	if buildContext == "" {
+		buildContext = "."
+	}
+	args = append(args, buildContext)
+
+	cmd := exec.Command("docker", args...)
+	// the build output goes to stderr, so the command output (e.g. the deployment id) stays machine readable
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if d.Endpoint != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("DOCKER_HOST=%s", d.Endpoint))
+	}
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to build image %s: %v", o.Image, err)
+	}
+
+	return readMetadataDigest(metadata.Name())
+}
+
+// readMetadataDigest reads the digest of the pushed image from the metadata file written by buildx.
+func readMetadataDigest(p string) (string, error) {
+	b, err := os.ReadFile(filepath.Clean(p))
+	if err != nil {
+		return "", err
+	}
+
+	m := struct {
+		Digest string `json:"containerimage.digest"`
+	}{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", fmt.Errorf("failed to read build metadata: %v", err)
+	}
+
+	if m.Digest == "" {
+		return "", fmt.Errorf("build metadata does not contain the image digest")
+	}
+
+	return m.Digest, nil
+}
+
+// RenderTag renders the tag template with the given data. The default template is used if tmpl is empty.
+func RenderTag(tmpl string, data TagData) (string, error) {
+	if tmpl == "" {
+		tmpl = DEFAULT_TAG_TEMPLATE
+	}
+
+	t, err := template.New("tag").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid tag template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid tag template: %v", err)
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Repository returns the repository part of an image reference, without tag nor digest.
+// e.g. localhost:5000/team/module:1.0 -> localhost:5000/team/module
+func Repository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+
+	// a colon after the last slash separates the tag, a colon before it belongs to the registry host port
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+
+	return image
+}
@@ -0,0 +1,49 @@
+package builder_test
+
+import (
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/builder"
+)
+
+func TestRepository(t *testing.T) {
+	tests := map[string]string{
+		"module":                               "module",
+		"module:1.0":                           "module",
+		"team/module:1.0":                      "team/module",
+		"localhost:5000/team/module":           "localhost:5000/team/module",
+		"localhost:5000/team/module:1.0":       "localhost:5000/team/module",
+		"myacr.azurecr.io/module@sha256:abcd":  "myacr.azurecr.io/module",
+		"localhost:5000/module:1.0@sha256:abc": "localhost:5000/module",
+	}
+
+	for image, expected := range tests {
+		if got := builder.Repository(image); got != expected {
+			t.Errorf("expected '%s' got '%s' for '%s'", expected, got, image)
+		}
+	}
+}
+
+func TestRenderTag(t *testing.T) {
+	tag, err := builder.RenderTag("", builder.TagData{Session: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag != "abc" {
+		t.Errorf("expected 'abc' got '%s'", tag)
+	}
+
+	tag, err = builder.RenderTag("draft-{{ .Session }}-{{ .Version }}", builder.TagData{Session: "abc", Version: "1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag != "draft-abc-1.0" {
+		t.Errorf("expected 'draft-abc-1.0' got '%s'", tag)
+	}
+
+	if _, err := builder.RenderTag("{{ .Unknown }}", builder.TagData{}); err == nil {
+		t.Error("expected an error for an unknown template field")
+	}
+}
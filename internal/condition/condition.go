@@ -0,0 +1,361 @@
+// Package condition parses and evaluates the IoT Hub twin query conditions, such as the target conditions of the
+// deployments (e.g. tags.environment='prod' AND properties.reported.version >= 2), so they can be validated and tested
+// against device twins before being released.
+package condition
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Condition is a parsed twin query condition.
+type Condition struct {
+	root node
+	text string
+}
+
+// Parse parses a twin query condition. Conditions refer to the twin properties through paths (tags.x,
+// properties.desired.x, properties.reported.x, deviceId, ...), compare them with =, !=, <>, <, <=, > and >=, test
+// lists with IN and NIN, combine predicates with AND, OR, NOT and parentheses, and call the type checking functions
+// (IS_DEFINED, IS_NULL, IS_BOOL, IS_NUMBER, IS_STRING, IS_OBJECT, IS_PRIMITIVE) and the string functions (STARTSWITH,
+// ENDSWITH). A SyntaxError locating the issue is returned if the condition is invalid.
+func Parse(s string) (*Condition, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 1 {
+		return nil, &SyntaxError{Pos: 0, Message: "empty condition"}
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, unexpected(t, "AND, OR or the end of the condition")
+	}
+
+	return &Condition{root: root, text: s}, nil
+}
+
+// String returns the condition in its normalized form.
+func (c *Condition) String() string {
+	return c.root.String()
+}
+
+// Match evaluates the condition against a twin, decoded from its JSON document (as returned by the IoT Hub). Like the
+// IoT Hub, predicates on undefined properties or on values of different types are undefined: they are false, and so is
+// their negation.
+func (c *Condition) Match(twin map[string]interface{}) bool {
+	v, ok := c.root.eval(twin)
+	b, isBool := v.(bool)
+	return ok && isBool && b
+}
+
+// MatchJSON evaluates the condition against the JSON document of a twin.
+func (c *Condition) MatchJSON(b []byte) (bool, error) {
+	twin := map[string]interface{}{}
+	if err := json.Unmarshal(b, &twin); err != nil {
+		return false, err
+	}
+
+	return c.Match(twin), nil
+}
+
+// node is a node of the syntax tree of a condition. Evaluating a node returns its value and whether it is defined.
+type node interface {
+	fmt.Stringer
+	eval(twin map[string]interface{}) (interface{}, bool)
+}
+
+// logical is an AND or OR of two conditions.
+type logical struct {
+	op          string
+	left, right node
+}
+
+func (n *logical) String() string {
+	return fmt.Sprintf("(%s %s %s)", n.left, n.op, n.right)
+}
+
+func (n *logical) eval(twin map[string]interface{}) (interface{}, bool) {
+	l, lok := asBool(n.left.eval(twin))
+	r, rok := asBool(n.right.eval(twin))
+
+	// a defined operand can decide the result on its own, e.g. false AND undefined is false
+	decisive := n.op == "OR"
+	if (lok && l == decisive) || (rok && r == decisive) {
+		return decisive, true
+	}
+
+	if !lok || !rok {
+		return nil, false
+	}
+
+	return !decisive, true
+}
+
+// not is the negation of a condition.
+type not struct {
+	x node
+}
+
+func (n *not) String() string {
+	return fmt.Sprintf("NOT %s", n.x)
+}
+
+func (n *not) eval(twin map[string]interface{}) (interface{}, bool) {
+	b, ok := asBool(n.x.eval(twin))
+	if !ok {
+		return nil, false
+	}
+
+	return !b, true
+}
+
+// comparison compares two operands.
+type comparison struct {
+	op          string
+	left, right node
+}
+
+func (n *comparison) String() string {
+	return fmt.Sprintf("%s %s %s", n.left, n.op, n.right)
+}
+
+func (n *comparison) eval(twin map[string]interface{}) (interface{}, bool) {
+	l, lok := n.left.eval(twin)
+	r, rok := n.right.eval(twin)
+	if !lok || !rok {
+		return nil, false
+	}
+
+	return compare(n.op, l, r)
+}
+
+// in tests whether an operand is one of the values of a list.
+type in struct {
+	negate bool
+	x      node
+	list   []node
+}
+
+func (n *in) String() string {
+	items := []string{}
+	for _, i := range n.list {
+		items = append(items, i.String())
+	}
+
+	op := "IN"
+	if n.negate {
+		op = "NIN"
+	}
+
+	return fmt.Sprintf("%s %s [%s]", n.x, op, strings.Join(items, ", "))
+}
+
+func (n *in) eval(twin map[string]interface{}) (interface{}, bool) {
+	v, ok := n.x.eval(twin)
+	if !ok {
+		return nil, false
+	}
+
+	for _, item := range n.list {
+		iv, ok := item.eval(twin)
+		if !ok {
+			continue
+		}
+
+		if eq, ok := compare("=", v, iv); ok && eq == true {
+			return !n.negate, true
+		}
+	}
+
+	return n.negate, true
+}
+
+// call is a function call.
+type call struct {
+	name string
+	args []node
+}
+
+func (n *call) String() string {
+	args := []string{}
+	for _, a := range n.args {
+		args = append(args, a.String())
+	}
+
+	return fmt.Sprintf("%s(%s)", n.name, strings.Join(args, ", "))
+}
+
+func (n *call) eval(twin map[string]interface{}) (interface{}, bool) {
+	v, ok := n.args[0].eval(twin)
+	if n.name == "IS_DEFINED" {
+		return ok, true
+	}
+
+	if !ok {
+		return nil, false
+	}
+
+	switch n.name {
+	case "IS_NULL":
+		return v == nil, true
+	case "IS_BOOL":
+		_, is := v.(bool)
+		return is, true
+	case "IS_NUMBER":
+		_, is := v.(float64)
+		return is, true
+	case "IS_STRING":
+		_, is := v.(string)
+		return is, true
+	case "IS_OBJECT":
+		_, is := v.(map[string]interface{})
+		return is, true
+	case "IS_PRIMITIVE":
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return false, true
+		}
+		return true, true
+	}
+
+	// string functions
+	s, sok := v.(string)
+	arg, aok := n.args[1].eval(twin)
+	affix, affixOk := arg.(string)
+	if !sok || !aok || !affixOk {
+		return nil, false
+	}
+
+	if n.name == "STARTSWITH" {
+		return strings.HasPrefix(s, affix), true
+	}
+
+	return strings.HasSuffix(s, affix), true
+}
+
+// path is a property path of the twin, e.g. tags.environment.
+type path struct {
+	segments []string
+}
+
+func (n *path) String() string {
+	return strings.Join(n.segments, ".")
+}
+
+func (n *path) eval(twin map[string]interface{}) (interface{}, bool) {
+	var v interface{} = twin
+	for _, s := range n.segments {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if v, ok = m[s]; !ok {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// literal is a string, number, boolean or null value.
+type literal struct {
+	value interface{}
+}
+
+func (n *literal) String() string {
+	switch v := n.value.(type) {
+	case string:
+		return fmt.Sprintf("'%s'", strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v))
+	case nil:
+		return "null"
+	}
+
+	return fmt.Sprint(n.value)
+}
+
+func (n *literal) eval(twin map[string]interface{}) (interface{}, bool) {
+	return n.value, true
+}
+
+// compare compares two values with a comparison operator. The result is undefined when the values are not of the same
+// type, or when they cannot be ordered.
+func compare(op string, l, r interface{}) (interface{}, bool) {
+	var c int
+	switch lv := l.(type) {
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return nil, false
+		}
+		c = strings.Compare(lv, rv)
+	case float64:
+		rv, ok := r.(float64)
+		if !ok {
+			return nil, false
+		}
+
+		switch {
+		case lv < rv:
+			c = -1
+		case lv > rv:
+			c = 1
+		}
+	case bool:
+		rv, ok := r.(bool)
+		if !ok || (op != "=" && op != "!=") {
+			return nil, false
+		}
+
+		if lv != rv {
+			c = 1
+		}
+	case nil:
+		if op != "=" && op != "!=" {
+			return nil, false
+		}
+
+		if r != nil {
+			c = 1
+		}
+	default:
+		return nil, false
+	}
+
+	switch op {
+	case "=":
+		return c == 0, true
+	case "!=":
+		return c != 0, true
+	case "<":
+		return c < 0, true
+	case "<=":
+		return c <= 0, true
+	case ">":
+		return c > 0, true
+	}
+
+	return c >= 0, true
+}
+
+// asBool returns an evaluated value as a boolean, undefined if it is not a boolean.
+func asBool(v interface{}, ok bool) (bool, bool) {
+	b, isBool := v.(bool)
+	return b, ok && isBool
+}
+
+// sortedStrings returns the strings sorted.
+func sortedStrings(s []string) []string {
+	sort.Strings(s)
+	return s
+}
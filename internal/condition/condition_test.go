@@ -0,0 +1,126 @@
+package condition_test
+
+import (
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/condition"
+)
+
+const twin = `{
+	"deviceId": "lab-gw-01",
+	"tags": {
+		"environment": "prod",
+		"application": {"myModule": "5f3c2a1b9d8e"},
+		"location": {"region": "eu-west", "floor": 2},
+		"retired": false,
+		"owner": null
+	},
+	"properties": {
+		"desired": {"telemetryInterval": 30},
+		"reported": {"firmware": "2.4.1", "battery": 87.5}
+	},
+	"capabilities": {"iotEdge": true}
+}`
+
+func TestMatch(t *testing.T) {
+	tests := map[string]bool{
+		"tags.environment='prod'":                                     true,
+		"tags.environment = \"prod\"":                                 true,
+		"tags.environment='dev'":                                      false,
+		"tags.environment!='dev'":                                     true,
+		"tags.environment<>'prod'":                                    false,
+		"tags.application.myModule='5f3c2a1b9d8e'":                    true,
+		"tags.location.floor >= 2 AND tags.location.floor < 3":        true,
+		"tags.location.floor > 2 OR tags.location.region = 'eu-west'": true,
+		"properties.reported.battery > 50":                            true,
+		"properties.desired.telemetryInterval = 30.0":                 true,
+		"capabilities.iotEdge = true":                                 true,
+		"tags.retired = false":                                        true,
+		"tags.owner = null":                                           true,
+		"IS_NULL(tags.owner)":                                         true,
+		"deviceId = 'lab-gw-01'":                                      true,
+		"deviceId IN ['lab-gw-01', 'lab-gw-02']":                      true,
+		"deviceId NIN ['lab-gw-01', 'lab-gw-02']":                     false,
+		"deviceId NOT IN ['lab-gw-02']":                               true,
+		"NOT (tags.environment = 'dev')":                              true,
+		"not tags.environment = 'prod'":                               false,
+		"IS_DEFINED(tags.location)":                                   true,
+		"is_defined(tags.missing)":                                    false,
+		"NOT IS_DEFINED(tags.missing)":                                true,
+		"IS_OBJECT(tags.location) AND IS_STRING(tags.environment)":    true,
+		"IS_NUMBER(properties.reported.battery)":                      true,
+		"IS_PRIMITIVE(tags.location)":                                 false,
+		"STARTSWITH(properties.reported.firmware, '2.')":              true,
+		"ENDSWITH(deviceId, '-02')":                                   false,
+		"(tags.environment = 'dev' OR tags.environment = 'prod') AND tags.location.region = 'eu-west'": true,
+		// predicates on undefined properties or values of different types are undefined, and so is their negation
+		"tags.missing = 'x'":                           false,
+		"tags.missing != 'x'":                          false,
+		"NOT (tags.missing = 'x')":                     false,
+		"tags.location.floor = '2'":                    false,
+		"tags.missing = 'x' OR deviceId = 'lab-gw-01'": true,
+		"tags.missing = 'x' AND deviceId = 'nope'":     false,
+	}
+
+	for cond, expected := range tests {
+		c, err := condition.Parse(cond)
+		if err != nil {
+			t.Errorf("%s: %v", cond, err)
+			continue
+		}
+
+		match, err := c.MatchJSON([]byte(twin))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if match != expected {
+			t.Errorf("%s: expected %v, got %v", cond, expected, match)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                           "empty condition at position 1",
+		"tags.environment = 'prod":   "unterminated string at position 20",
+		"tags.environment == 'prod'": "unexpected '=', expected a property path or a value at position 19",
+		"tags.environment 'prod'":    "'tags.environment' must be compared, expected a comparison operator after it at position 1",
+		"tag.environment = 'prod'":   "unknown property 'tag' (expected one of capabilities, connectionState, deviceId, modelId, moduleId, properties, status, tags) at position 1",
+		"properties.version = 1":     "properties must be followed by desired or reported (e.g. properties.reported.version) at position 1",
+		"(tags.a = 1":                "unexpected end of condition, expected ')' at position 12",
+		"tags.a = 1)":                "unexpected ')', expected AND, OR or the end of the condition at position 11",
+		"tags.a = 1 AND":             "unexpected end of condition, expected a property path or a value at position 15",
+		"tags.a = 1 tags.b = 2":      "unexpected 'tags', expected AND, OR or the end of the condition at position 12",
+		"CONTAINS(tags.a, 'x')":      "unknown function 'CONTAINS' (expected one of ENDSWITH, IS_BOOL, IS_DEFINED, IS_NULL, IS_NUMBER, IS_OBJECT, IS_PRIMITIVE, IS_STRING, STARTSWITH) at position 1",
+		"STARTSWITH(tags.a)":         "STARTSWITH expects 2 argument(s), got 1 at position 1",
+		"IS_DEFINED('x')":            "IS_DEFINED expects a property path at position 1",
+		"tags.a IN 'x'":              "unexpected ''x'', expected '[' at position 11",
+		"tags.a ! = 1":               "unexpected '!', use != or NOT at position 8",
+		"tags.a = 1 && tags.b = 2":   "unexpected character '&' at position 12",
+	}
+
+	for cond, expected := range tests {
+		_, err := condition.Parse(cond)
+		if err == nil {
+			t.Errorf("%s: expected an error", cond)
+			continue
+		}
+
+		if err.Error() != expected {
+			t.Errorf("%s: expected '%s', got '%s'", cond, expected, err)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	c, err := condition.Parse("tags.a='x' and not (tags.b <> 1 or deviceId in ['d1', \"it's\"])")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `(tags.a = 'x' AND NOT (tags.b != 1 OR deviceId IN ['d1', 'it\'s']))`
+	if c.String() != expected {
+		t.Errorf("expected %s, got %s", expected, c)
+	}
+}
@@ -0,0 +1,14 @@
+package condition
+
+import "fmt"
+
+// SyntaxError describes an invalid condition, pos is the offset of the error in the condition.
+type SyntaxError struct {
+	Pos     int
+	Message string
+}
+
+// Implement the error interface
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Pos+1)
+}
@@ -0,0 +1,144 @@
+package condition
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// tokenKind is the kind of a token of a condition.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+	tokenDot
+)
+
+// token is a lexical token of a condition, pos is its offset in the condition.
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+// is reports whether the token is the given keyword, keywords are case insensitive.
+func (t token) is(keyword string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+// lex splits a condition into tokens.
+func lex(s string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{kind: tokenLBracket, text: "[", pos: i})
+			i++
+		case r == ']':
+			tokens = append(tokens, token{kind: tokenRBracket, text: "]", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+		case r == '.':
+			tokens = append(tokens, token{kind: tokenDot, text: ".", pos: i})
+			i++
+		case strings.ContainsRune("=!<>", r):
+			op := string(r)
+			if i+1 < len(runes) && ((r != '=' && runes[i+1] == '=') || (r == '<' && runes[i+1] == '>')) {
+				op += string(runes[i+1])
+			}
+
+			if op == "!" {
+				return nil, &SyntaxError{Pos: i, Message: "unexpected '!', use != or NOT"}
+			}
+
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+			i += len(op)
+		case r == '\'' || r == '"':
+			str, n, err := lexString(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[i : i+n]), value: str, pos: i})
+			i += n
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || strings.ContainsRune(".eE", runes[j]) ||
+				((runes[j] == '-' || runes[j] == '+') && strings.ContainsRune("eE", runes[j-1]))) {
+				j++
+			}
+
+			text := string(runes[i:j])
+			n, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, &SyntaxError{Pos: i, Message: "invalid number '" + text + "'"}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: n, pos: i})
+			i = j
+		case isIdentStart(r):
+			j := i + 1
+			for j < len(runes) && isIdentPart(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[i:j]), pos: i})
+			i = j
+		default:
+			return nil, &SyntaxError{Pos: i, Message: "unexpected character '" + string(r) + "'"}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+// lexString reads a quoted string starting at i, returning its value and its length in the condition. Quotes and
+// backslashes can be escaped with a backslash.
+func lexString(runes []rune, i int) (string, int, error) {
+	quote := runes[i]
+
+	var b strings.Builder
+	for j := i + 1; j < len(runes); j++ {
+		switch runes[j] {
+		case '\\':
+			if j+1 < len(runes) {
+				j++
+				b.WriteRune(runes[j])
+			}
+		case quote:
+			return b.String(), j - i + 1, nil
+		default:
+			b.WriteRune(runes[j])
+		}
+	}
+
+	return "", 0, &SyntaxError{Pos: i, Message: "unterminated string"}
+}
+
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '$'
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || r == '-'
+}
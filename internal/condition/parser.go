@@ -0,0 +1,301 @@
+package condition
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pathRoots holds the twin properties a condition can refer to, properties must be followed by desired or reported.
+var pathRoots = map[string]bool{
+	"deviceId":        true,
+	"moduleId":        true,
+	"tags":            true,
+	"properties":      true,
+	"capabilities":    true,
+	"status":          true,
+	"connectionState": true,
+	"modelId":         true,
+}
+
+// functions holds the number of arguments of the functions of the grammar, by upper case name. Every function returns
+// a boolean.
+var functions = map[string]int{
+	"IS_DEFINED":   1,
+	"IS_NULL":      1,
+	"IS_BOOL":      1,
+	"IS_NUMBER":    1,
+	"IS_STRING":    1,
+	"IS_OBJECT":    1,
+	"IS_PRIMITIVE": 1,
+	"STARTSWITH":   2,
+	"ENDSWITH":     2,
+}
+
+// comparisons holds the comparison operators, the <> operator being normalized to !=.
+var comparisons = map[string]string{
+	"=":  "=",
+	"!=": "!=",
+	"<>": "!=",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+}
+
+// parser is a recursive descent parser of the condition grammar:
+//
+//	condition  = and { OR and }
+//	and        = not { AND not }
+//	not        = NOT not | "(" condition ")" | predicate
+//	predicate  = operand ( comparison operand | [ NOT ] IN list | NIN list ) | function
+//	operand    = path | string | number | TRUE | FALSE | NULL | function
+//	function   = name "(" operand { "," operand } ")"
+//	list       = "[" operand { "," operand } "]"
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, unexpected(t, what)
+	}
+	return t, nil
+}
+
+// unexpected returns the syntax error of an unexpected token.
+func unexpected(t token, what string) error {
+	if t.kind == tokenEOF {
+		return &SyntaxError{Pos: t.pos, Message: fmt.Sprintf("unexpected end of condition, expected %s", what)}
+	}
+	return &SyntaxError{Pos: t.pos, Message: fmt.Sprintf("unexpected '%s', expected %s", t.text, what)}
+}
+
+func (p *parser) parseCondition() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().is("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "OR", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().is("AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "AND", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	t := p.peek()
+	switch {
+	case t.is("NOT"):
+		p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &not{x: x}, nil
+	case t.kind == tokenLParen:
+		p.next()
+		x, err := p.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := p.expect(tokenRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+
+	return p.parsePredicate()
+}
+
+func (p *parser) parsePredicate() (node, error) {
+	start := p.peek()
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	switch {
+	case t.kind == tokenOperator:
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &comparison{op: comparisons[t.text], left: left, right: right}, nil
+	case t.is("IN"), t.is("NIN"), t.is("NOT") && p.tokens[p.pos+1].is("IN"):
+		negate := !t.is("IN")
+		if p.next().is("NOT") {
+			p.next()
+		}
+
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &in{negate: negate, x: left, list: list}, nil
+	}
+
+	// a function call is a condition by itself, other operands must be compared
+	if _, ok := left.(*call); ok {
+		return left, nil
+	}
+
+	return nil, &SyntaxError{Pos: start.pos, Message: fmt.Sprintf("'%s' must be compared, expected a comparison operator after it", left)}
+}
+
+func (p *parser) parseOperand() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString, tokenNumber:
+		return &literal{value: t.value}, nil
+	case tokenIdent:
+		switch {
+		case t.is("TRUE"):
+			return &literal{value: true}, nil
+		case t.is("FALSE"):
+			return &literal{value: false}, nil
+		case t.is("NULL"):
+			return &literal{value: nil}, nil
+		case p.peek().kind == tokenLParen:
+			return p.parseCall(t)
+		}
+		return p.parsePath(t)
+	}
+
+	return nil, unexpected(t, "a property path or a value")
+}
+
+func (p *parser) parsePath(first token) (node, error) {
+	if !pathRoots[first.text] {
+		roots := []string{}
+		for r := range pathRoots {
+			roots = append(roots, r)
+		}
+		return nil, &SyntaxError{Pos: first.pos, Message: fmt.Sprintf("unknown property '%s' (expected one of %s)", first.text, strings.Join(sortedStrings(roots), ", "))}
+	}
+
+	path := &path{segments: []string{first.text}}
+	for p.peek().kind == tokenDot {
+		p.next()
+		t, err := p.expect(tokenIdent, "a property name")
+		if err != nil {
+			return nil, err
+		}
+		path.segments = append(path.segments, t.text)
+	}
+
+	if first.text == "properties" && (len(path.segments) < 2 || (path.segments[1] != "desired" && path.segments[1] != "reported")) {
+		return nil, &SyntaxError{Pos: first.pos, Message: "properties must be followed by desired or reported (e.g. properties.reported.version)"}
+	}
+
+	return path, nil
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn := strings.ToUpper(name.text)
+	arity, ok := functions[fn]
+	if !ok {
+		names := []string{}
+		for f := range functions {
+			names = append(names, f)
+		}
+		return nil, &SyntaxError{Pos: name.pos, Message: fmt.Sprintf("unknown function '%s' (expected one of %s)", name.text, strings.Join(sortedStrings(names), ", "))}
+	}
+
+	p.next()
+	c := &call{name: fn}
+	if p.peek().kind != tokenRParen {
+		for {
+			arg, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			c.args = append(c.args, arg)
+
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if _, err := p.expect(tokenRParen, "')'"); err != nil {
+		return nil, err
+	}
+
+	if len(c.args) != arity {
+		return nil, &SyntaxError{Pos: name.pos, Message: fmt.Sprintf("%s expects %d argument(s), got %d", fn, arity, len(c.args))}
+	}
+
+	if fn == "IS_DEFINED" {
+		if _, ok := c.args[0].(*path); !ok {
+			return nil, &SyntaxError{Pos: name.pos, Message: "IS_DEFINED expects a property path"}
+		}
+	}
+
+	return c, nil
+}
+
+func (p *parser) parseList() ([]node, error) {
+	if _, err := p.expect(tokenLBracket, "'['"); err != nil {
+		return nil, err
+	}
+
+	list := []node{}
+	for {
+		item, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+
+		t := p.next()
+		if t.kind == tokenRBracket {
+			return list, nil
+		}
+
+		if t.kind != tokenComma {
+			return nil, unexpected(t, "',' or ']'")
+		}
+	}
+}
@@ -1,26 +1,52 @@
 package configuration
 
-const CONFIG_VERSION = 1
+const CONFIG_VERSION = 2
+
+// STRATEGY_DEPLOYMENT deploys the drafts with a layered deployment targeting the device through its twin tags, the
+// default strategy.
+const STRATEGY_DEPLOYMENT = "deployment"
+
+// STRATEGY_DIRECT deploys the drafts by applying the modules to the deployment manifest of the device directly.
+const STRATEGY_DIRECT = "direct"
 
 type Configuration struct {
 	// Id is the unique identifier of the session.
 	Id string `mapstructure:"session"`
 	// Version is the version of the configuration file.
 	Version int `mapstructure:"version"`
+	// PreviousSessions holds the ids of the former sessions, oldest first, recorded when the session is rotated.
+	PreviousSessions []string `mapstructure:"previous-sessions,omitempty"`
+
+	// Modules holds the modules to deploy. The first module is the main module, the one handled by the draft commands.
+	Modules []Module `mapstructure:"modules"`
+
+	// Routes holds the edge hub routes to deploy along with the modules, by route name.
+	Routes map[string]string `mapstructure:"routes,omitempty"`
+
+	// Registries holds the credentials of the container registries hosting the module images.
+	Registries []Registry `mapstructure:"registries,omitempty"`
+
+	// Rollout holds the staged rollout plan of the releases.
+	Rollout Rollout `mapstructure:"rollout,omitempty"`
+
+	// Environments holds named overlays of the configuration (e.g. staging, prod).
+	Environments map[string]map[string]interface{} `mapstructure:"environments,omitempty"`
 
-	// Module struct holds the module information.
-	Module struct {
-		// Name is the name of the module in the edge workload controller runtime.
-		Name string `mapstructure:"name,omitempty"`
-		// StartupOrder is the startup order of the module in the cloud provider.
-		StartupOrder int `mapstructure:"startup-order,omitempty"`
-		// CreateOptions is the create options of the module in the cloud provider.
-		CreateOptions string `mapstructure:"create-options,omitempty"`
-		// Image is URL of the image to be used for the module.
-		Image string `mapstructure:"image,omitempty"`
-		// Env is the environment variables to be set in the module at runtime.
-		Env []string `mapstructure:"env,omitempty"`
-	} `mapstructure:"module"`
+	// Build struct holds the information to build the module image from source.
+	Build struct {
+		// Context is the path of the docker build context.
+		Context string `mapstructure:"context,omitempty"`
+		// Dockerfile is the path of the Dockerfile used to build the image.
+		Dockerfile string `mapstructure:"dockerfile,omitempty"`
+		// Platforms is the list of platforms to build the image for (e.g. linux/arm64).
+		Platforms []string `mapstructure:"platforms,omitempty"`
+		// Tag is the template of the image tag, the session id is available as {{ .Session }}.
+		Tag string `mapstructure:"tag,omitempty"`
+		// Endpoint is the docker endpoint to build with, the docker CLI default is used when empty.
+		Endpoint string `mapstructure:"endpoint,omitempty"`
+		// Builder is the name of the buildx builder instance to use.
+		Builder string `mapstructure:"builder,omitempty"`
+	} `mapstructure:"build"`
 
 	Deployment struct {
 		// Id is the deployment id of the module in the cloud provider.
@@ -29,21 +55,138 @@ type Configuration struct {
 		Priority int16 `mapstructure:"priority"`
 		// TargetCondition is the target condition of the module in the cloud provider.
 		TargetCondition string `mapstructure:"target-condition"`
+		// Metrics holds the custom metrics of the deployment, the queries counting the devices. They are written as a
+		// mapping of the queries by metric name in the configuration file, see Normalize.
+		Metrics []Metric `mapstructure:"metrics,omitempty"`
 	} `mapstructure:"deployment"`
 
 	// Device struct holds the development device information.
 	Device struct {
 		// Name is the name of the device in the cloud provider.
 		Name string `mapstructure:"name"`
+		// Platform is the platform of the device in the os/arch[/variant] form (e.g. linux/arm64).
+		Platform string `mapstructure:"platform,omitempty"`
+		// Strategy is how the drafts are deployed to the device, STRATEGY_DEPLOYMENT or STRATEGY_DIRECT.
+		Strategy string `mapstructure:"strategy,omitempty"`
 	} `mapstructure:"device"`
 
 	// Infra struct holds the infrastructure information.
 	Infra struct {
 		// Hub is the name of the IoT Hub where the development device is connected.
 		Hub string `mapstructure:"hub"`
+		// Hubs holds the IoT Hubs the releases are sent to, e.g. one per region, instead of the hub.
+		Hubs []Hub `mapstructure:"hubs,omitempty"`
 	} `mapstructure:"infra"`
 
 	Auth struct {
 		Token string `mapstructure:"token"`
 	} `mapstructure:"auth"`
 }
+
+// Module holds the information of a module to deploy.
+type Module struct {
+	// Name is the name of the module in the edge workload controller runtime.
+	Name string `mapstructure:"name,omitempty"`
+	// StartupOrder is the startup order of the module in the cloud provider.
+	StartupOrder int `mapstructure:"startup-order,omitempty"`
+	// CreateOptions is the create options of the module in the cloud provider.
+	CreateOptions string `mapstructure:"create-options,omitempty"`
+	// Image is URL of the image to be used for the module.
+	Image string `mapstructure:"image,omitempty"`
+	// Env is the environment variables to be set in the module at runtime.
+	Env []string `mapstructure:"env,omitempty"`
+}
+
+// Rollout holds the staged rollout plan of the releases: the release is deployed to a growing part of the devices
+// matched by the target condition, step by step, as long as the devices are healthy. The whole target is released at
+// once when the plan has no steps.
+type Rollout struct {
+	// RingTag is the twin tag naming the ring of the devices (e.g. ring for tags.ring), the steps then target rings
+	// instead of percentages of the devices.
+	RingTag string `mapstructure:"ring-tag,omitempty"`
+	// Steps holds the steps of the rollout, the release is deployed to the whole target once the last step is healthy.
+	Steps []RolloutStep `mapstructure:"steps,omitempty"`
+	// Health holds the criteria a step must meet before the rollout goes on.
+	Health RolloutHealth `mapstructure:"health,omitempty"`
+}
+
+// RolloutStep holds a step of a rollout. A step without ring nor percentage targets the whole target.
+type RolloutStep struct {
+	// Name is the name of the step shown in the progress, defaults to the ring or the percentage.
+	Name string `mapstructure:"name,omitempty"`
+	// Percent is the percentage of the target devices the step deploys to.
+	Percent int `mapstructure:"percent,omitempty"`
+	// Ring is the ring the step adds to the rings of the previous steps.
+	Ring string `mapstructure:"ring,omitempty"`
+	// Wait is the minimum duration the devices of the step must run the release before the next step (e.g. 10m).
+	Wait string `mapstructure:"wait,omitempty"`
+}
+
+// RolloutHealth holds the health criteria of the rollout steps.
+type RolloutHealth struct {
+	// MinHealthy is the percentage of the devices of a step which must run every module of the release.
+	MinHealthy int `mapstructure:"min-healthy,omitempty"`
+	// MaxFailed is the number of devices of a step which can fail before the rollout is aborted.
+	MaxFailed int `mapstructure:"max-failed,omitempty"`
+	// Timeout is the duration after which a step which is not healthy is aborted (e.g. 30m).
+	Timeout string `mapstructure:"timeout,omitempty"`
+	// Interval is the duration between two health checks (e.g. 30s).
+	Interval string `mapstructure:"interval,omitempty"`
+}
+
+// Hub holds an IoT Hub the releases are sent to.
+type Hub struct {
+	// Name is the name of the IoT Hub.
+	Name string `mapstructure:"name"`
+	// Token is the token to authenticate against the hub, the token of the auth section is used when empty.
+	Token string `mapstructure:"token,omitempty"`
+}
+
+// Registry holds the credentials of a container registry.
+type Registry struct {
+	// Server is the registry host (and port) the credentials apply to, they apply to every registry when empty.
+	Server string `mapstructure:"server,omitempty"`
+	// Username is the user to authenticate against the registry.
+	Username string `mapstructure:"username,omitempty"`
+	// Password is the password to authenticate against the registry.
+	Password string `mapstructure:"password,omitempty"`
+	// Token is a bearer token to authenticate against the registry, it takes precedence over username and password.
+	Token string `mapstructure:"token,omitempty"`
+	// Insecure allows reaching the registry through plain HTTP.
+	Insecure bool `mapstructure:"insecure,omitempty"`
+}
+
+// MainModule returns the main module of the configuration, the first one of the modules list. An empty module is added
+// if the configuration has none, so the returned module can always be filled in.
+func (c *Configuration) MainModule() *Module {
+	if len(c.Modules) == 0 {
+		c.Modules = append(c.Modules, Module{})
+	}
+
+	return &c.Modules[0]
+}
+
+// RegistryFor returns the credentials of the given registry server. Credentials without server are used as fallback,
+// nil is returned if no credentials apply.
+func (c *Configuration) RegistryFor(server string) *Registry {
+	var fallback *Registry
+	for i, r := range c.Registries {
+		if r.Server == server {
+			return &c.Registries[i]
+		}
+
+		if r.Server == "" && fallback == nil {
+			fallback = &c.Registries[i]
+		}
+	}
+
+	return fallback
+}
+
+// Metric is a custom metric of the deployment, a query counting the devices.
+type Metric struct {
+	// Name is the name of the metric (camelCase).
+	Name string `mapstructure:"name"`
+	// Query is the query counting the devices, e.g. SELECT deviceId FROM devices WHERE <condition>.
+	Query string `mapstructure:"query"`
+}
@@ -0,0 +1,68 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// CONFIG_FILE_NAME is the name of the project configuration file.
+const CONFIG_FILE_NAME = "edge-leap.yaml"
+
+// CONFIG_ENV is the environment variable holding the path of the configuration file, it takes precedence over the
+// configuration file discovery.
+const CONFIG_ENV = "ELCLI_CONFIG"
+
+// Discover returns the path of the nearest configuration file, looking in the given directory then in each of its
+// parents up to the filesystem root, like git does for its repository. ConfigNotFoundError is returned if none is found.
+func Discover(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for d := dir; ; {
+		path := filepath.Join(d, CONFIG_FILE_NAME)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", &ConfigNotFoundError{Dir: dir}
+		}
+		d = parent
+	}
+}
+
+// UserConfigFile returns the path of the user configuration file, $XDG_CONFIG_HOME/elcli/config.yaml or
+// ~/.config/elcli/config.yaml. An empty path is returned if the home directory cannot be determined.
+func UserConfigFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "elcli", "config.yaml")
+}
+
+// MergeDefaults merges in place the defaults of a raw user configuration under a raw project configuration: values of
+// the project configuration take precedence, mappings are deep merged and lists follow the environments merge rules.
+// The generated keys of the user configuration (e.g. the session) are ignored.
+func MergeDefaults(raw, defaults map[string]interface{}) {
+	for k, v := range defaults {
+		if generatedKeys[k] {
+			continue
+		}
+
+		overlay, ok := raw[k]
+		if !ok || overlay == nil {
+			raw[k] = v
+			continue
+		}
+		raw[k] = mergeValue(k, v, overlay)
+	}
+}
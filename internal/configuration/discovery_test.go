@@ -0,0 +1,103 @@
+package configuration_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+func TestDiscover(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "src", "module")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := configuration.Discover(nested); err == nil {
+		t.Fatal("expected an error when there is no configuration file")
+	} else if _, ok := err.(*configuration.ConfigNotFoundError); !ok {
+		t.Fatalf("expected ConfigNotFoundError, got %T", err)
+	}
+
+	expected := filepath.Join(root, configuration.CONFIG_FILE_NAME)
+	if err := os.WriteFile(expected, []byte("version: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{root, nested} {
+		path, err := configuration.Discover(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if path != expected {
+			t.Errorf("expected %s from %s, got %s", expected, dir, path)
+		}
+	}
+
+	// a directory named like the configuration file is not a configuration file
+	if err := os.Mkdir(filepath.Join(nested, configuration.CONFIG_FILE_NAME), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if path, err := configuration.Discover(nested); err != nil || path != expected {
+		t.Errorf("expected %s, got %s (%v)", expected, path, err)
+	}
+}
+
+func TestUserConfigFile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if path := configuration.UserConfigFile(); path != "/xdg/elcli/config.yaml" {
+		t.Errorf("expected /xdg/elcli/config.yaml, got %s", path)
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", "/home/dev")
+	if path := configuration.UserConfigFile(); path != "/home/dev/.config/elcli/config.yaml" {
+		t.Errorf("expected /home/dev/.config/elcli/config.yaml, got %s", path)
+	}
+}
+
+func TestMergeDefaults(t *testing.T) {
+	defaults, _, err := configuration.Decode([]byte(`
+version: 2
+session: ignored
+infra:
+  hub: default-hub
+auth:
+  token: env:AZURE_TOKEN
+deployment:
+  priority: 10
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _, err := configuration.Decode([]byte(`
+version: 2
+session: 5f3c2a1b9d8e
+deployment:
+  id: my-module
+infra:
+  hub: project-hub
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configuration.MergeDefaults(raw, defaults)
+
+	expected := map[string]interface{}{
+		"version":    2,
+		"session":    "5f3c2a1b9d8e",
+		"deployment": map[string]interface{}{"id": "my-module", "priority": 10},
+		"infra":      map[string]interface{}{"hub": "project-hub"},
+		"auth":       map[string]interface{}{"token": "env:AZURE_TOKEN"},
+	}
+	if !reflect.DeepEqual(raw, expected) {
+		t.Errorf("expected %v, got %v", expected, raw)
+	}
+}
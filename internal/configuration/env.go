@@ -0,0 +1,115 @@
+package configuration
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ENV_PREFIX is the prefix of the environment variables overriding the configuration settings.
+const ENV_PREFIX = "ELCLI"
+
+// MODULE_ENV_KEY is the pseudo key of the main module settings overridden through environment variables
+// (e.g. ELCLI_MODULE_IMAGE), since list items such as modules[0] cannot be named by an environment variable.
+const MODULE_ENV_KEY = "module"
+
+// EnvKeyReplacer maps the configuration keys to the environment variable names, dots and dashes becoming underscores.
+var EnvKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// envAliases holds the environment variables also overriding a setting, for compatibility with existing pipelines.
+var envAliases = map[string][]string{
+	"auth.token": {"AZURE_TOKEN"},
+}
+
+// EnvVar returns the environment variable overriding a configuration key, e.g. ELCLI_AUTH_TOKEN for auth.token or
+// ELCLI_DEPLOYMENT_TARGET_CONDITION for deployment.target-condition.
+func EnvVar(key string) string {
+	return ENV_PREFIX + "_" + strings.ToUpper(EnvKeyReplacer.Replace(key))
+}
+
+// EnvVars returns the environment variables overriding a configuration key, the prefixed one first followed by its
+// aliases.
+func EnvVars(key string) []string {
+	return append([]string{EnvVar(key)}, envAliases[key]...)
+}
+
+// generatedKeys holds the configuration keys written by the client itself, which cannot be overridden.
+var generatedKeys = map[string]bool{
+	"session":           true,
+	"version":           true,
+	"previous-sessions": true,
+}
+
+// EnvKeys returns the configuration keys that can be overridden through environment variables: every setting, and the
+// main module settings under the module pseudo key. The generated keys (e.g. the session) and the environments overlays
+// are not part of them. The lists of mappings (e.g. registries) and the mappings (e.g. routes) are set as a whole, the
+// environment variable holding a JSON or YAML document, see EnvDecodeHook.
+func EnvKeys() []string {
+	keys := envKeys(reflect.TypeOf(Configuration{}), "")
+	for _, k := range envKeys(reflect.TypeOf(Module{}), MODULE_ENV_KEY) {
+		if k != MODULE_ENV_KEY+".env" {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// envKeys returns the keys of the value settings of a structure found at the given path.
+func envKeys(t reflect.Type, path string) []string {
+	keys := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if name == "" || name == "-" || !f.IsExported() || generatedKeys[name] {
+			continue
+		}
+
+		key := joinPath(path, name)
+		switch f.Type.Kind() {
+		case reflect.Struct:
+			keys = append(keys, envKeys(f.Type, key)...)
+		case reflect.Slice, reflect.Map:
+			if k := f.Type.Elem().Kind(); k != reflect.Map && k != reflect.Interface {
+				keys = append(keys, key)
+			}
+		case reflect.Interface:
+		default:
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// EnvDecodeHook decodes the lists of mappings and the mappings set through environment variables, whose value is a JSON
+// or YAML document, e.g. ELCLI_REGISTRIES='[{"server": "myacr.azurecr.io", "token": "..."}]'. The metrics and the
+// environment variables of the modules can be written in their mapping form, like in the configuration file.
+func EnvDecodeHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	s, ok := data.(string)
+	if !ok || from.Kind() != reflect.String {
+		return data, nil
+	}
+
+	if to.Kind() != reflect.Map && (to.Kind() != reflect.Slice || to.Elem().Kind() != reflect.Struct) {
+		return data, nil
+	}
+
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+		return nil, fmt.Errorf("invalid %s value: %v", to, err)
+	}
+
+	switch to {
+	case reflect.TypeOf([]Metric{}):
+		d := map[string]interface{}{"metrics": v}
+		normalizeDeploymentMetrics(d)
+		v = d["metrics"]
+	case reflect.TypeOf([]Module{}):
+		normalizeModulesEnv(v)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,115 @@
+package configuration_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+func TestEnvVar(t *testing.T) {
+	tests := map[string]string{
+		"auth.token":                  "ELCLI_AUTH_TOKEN",
+		"deployment.target-condition": "ELCLI_DEPLOYMENT_TARGET_CONDITION",
+		"module.image":                "ELCLI_MODULE_IMAGE",
+	}
+
+	for key, expected := range tests {
+		if v := configuration.EnvVar(key); v != expected {
+			t.Errorf("expected %s for %s, got %s", expected, key, v)
+		}
+	}
+
+	expected := []string{"ELCLI_AUTH_TOKEN", "AZURE_TOKEN"}
+	if vars := configuration.EnvVars("auth.token"); !reflect.DeepEqual(vars, expected) {
+		t.Errorf("expected %v, got %v", expected, vars)
+	}
+}
+
+func TestEnvKeys(t *testing.T) {
+	expected := []string{
+		"modules",
+		"routes",
+		"registries",
+		"rollout.ring-tag",
+		"rollout.steps",
+		"rollout.health.min-healthy",
+		"rollout.health.max-failed",
+		"rollout.health.timeout",
+		"rollout.health.interval",
+		"build.context",
+		"build.dockerfile",
+		"build.platforms",
+		"build.tag",
+		"build.endpoint",
+		"build.builder",
+		"deployment.id",
+		"deployment.priority",
+		"deployment.target-condition",
+		"deployment.metrics",
+		"device.name",
+		"device.platform",
+		"device.strategy",
+		"infra.hub",
+		"infra.hubs",
+		"auth.token",
+		"module.name",
+		"module.startup-order",
+		"module.create-options",
+		"module.image",
+	}
+
+	if keys := configuration.EnvKeys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+}
+
+func TestEnvDecodeHook(t *testing.T) {
+	t.Setenv("ELCLI_REGISTRIES", `[{"server": "myacr.azurecr.io", "token": "registry-token"}]`)
+	t.Setenv("ELCLI_ROUTES", `{"Upstream": "FROM /messages/* INTO $upstream"}`)
+	t.Setenv("ELCLI_DEPLOYMENT_METRICS", "running: SELECT deviceId FROM devices")
+	t.Setenv("ELCLI_MODULES", `[{"name": "myModule", "env": {"LOG_LEVEL": "debug"}}]`)
+	t.Setenv("ELCLI_BUILD_PLATFORMS", "linux/amd64,linux/arm64")
+
+	// the settings are loaded like the commands do
+	v := viper.New()
+	v.SetEnvPrefix(configuration.ENV_PREFIX)
+	v.SetEnvKeyReplacer(configuration.EnvKeyReplacer)
+	for _, k := range configuration.EnvKeys() {
+		v.BindEnv(append([]string{k}, configuration.EnvVars(k)...)...)
+	}
+
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader([]byte("registries:\n  - username: user\n"))); err != nil {
+		t.Fatal(err)
+	}
+
+	c := configuration.Configuration{}
+	hook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(configuration.EnvDecodeHook, mapstructure.StringToSliceHookFunc(",")))
+	if err := v.Unmarshal(&c, hook); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []configuration.Registry{{Server: "myacr.azurecr.io", Token: "registry-token"}}; !reflect.DeepEqual(c.Registries, expected) {
+		t.Errorf("expected registries %v, got %v", expected, c.Registries)
+	}
+
+	if c.Routes["Upstream"] != "FROM /messages/* INTO $upstream" {
+		t.Errorf("expected the routes to keep their case, got %v", c.Routes)
+	}
+
+	if expected := []configuration.Metric{{Name: "running", Query: "SELECT deviceId FROM devices"}}; !reflect.DeepEqual(c.Deployment.Metrics, expected) {
+		t.Errorf("expected metrics %v, got %v", expected, c.Deployment.Metrics)
+	}
+
+	if len(c.Modules) != 1 || !reflect.DeepEqual(c.Modules[0].Env, []string{"LOG_LEVEL=debug"}) {
+		t.Errorf("expected the module env to be normalized, got %v", c.Modules)
+	}
+
+	if expected := []string{"linux/amd64", "linux/arm64"}; !reflect.DeepEqual(c.Build.Platforms, expected) {
+		t.Errorf("expected platforms %v, got %v", expected, c.Build.Platforms)
+	}
+}
@@ -0,0 +1,119 @@
+package configuration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ApplyEnvironment overlays the named environment of a raw configuration onto the configuration itself. Mappings are
+// deep merged and the environment values take precedence. Lists are replaced, except modules which are merged by module
+// name, module environment variables which are merged by variable name and deployment metrics which are merged by
+// metric name. An error is returned if the environment is
+// not defined in the configuration.
+func ApplyEnvironment(raw map[string]interface{}, name string) error {
+	environments, _ := raw["environments"].(map[string]interface{})
+
+	overlay, ok := environments[name]
+	if !ok {
+		available := []string{}
+		for k := range environments {
+			available = append(available, k)
+		}
+		sort.Strings(available)
+
+		if len(available) == 0 {
+			return fmt.Errorf("unknown environment '%s', the configuration has no environments", name)
+		}
+		return fmt.Errorf("unknown environment '%s' (available: %s)", name, strings.Join(available, ", "))
+	}
+
+	if overlay == nil {
+		return nil
+	}
+
+	o, ok := overlay.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("environment '%s' must be a mapping", name)
+	}
+
+	for k, v := range o {
+		if k == "environments" || k == "version" {
+			return fmt.Errorf("environment '%s' cannot set '%s'", name, k)
+		}
+		raw[k] = mergeValue(k, raw[k], v)
+	}
+
+	return nil
+}
+
+// mergeValue merges an overlay value onto a base value found under the given key.
+func mergeValue(key string, base, overlay interface{}) interface{} {
+	switch o := overlay.(type) {
+	case map[string]interface{}:
+		b, ok := base.(map[string]interface{})
+		if !ok {
+			return o
+		}
+
+		merged := map[string]interface{}{}
+		for k, v := range b {
+			merged[k] = v
+		}
+
+		for k, v := range o {
+			merged[k] = mergeValue(k, merged[k], v)
+		}
+
+		return merged
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok {
+			return o
+		}
+
+		switch key {
+		case "modules", "metrics":
+			return mergeList(b, o, func(v interface{}) string {
+				m, _ := v.(map[string]interface{})
+				name, _ := m["name"].(string)
+				return name
+			})
+		case "env":
+			return mergeList(b, o, func(v interface{}) string {
+				s, _ := v.(string)
+				k, _, _ := strings.Cut(s, "=")
+				return k
+			})
+		}
+
+		return o
+	}
+
+	return overlay
+}
+
+// mergeList merges two lists whose items are identified by a key. Overlay items with the same key as a base item are
+// merged onto it, the others are appended. Items without key are always appended.
+func mergeList(base, overlay []interface{}, key func(interface{}) string) []interface{} {
+	merged := append([]interface{}{}, base...)
+
+	index := map[string]int{}
+	for i, v := range merged {
+		if k := key(v); k != "" {
+			index[k] = i
+		}
+	}
+
+	for _, v := range overlay {
+		k := key(v)
+		if i, ok := index[k]; ok && k != "" {
+			merged[i] = mergeValue("", merged[i], v)
+			continue
+		}
+
+		merged = append(merged, v)
+	}
+
+	return merged
+}
@@ -0,0 +1,83 @@
+package configuration_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+func TestApplyEnvironment(t *testing.T) {
+	content := `
+version: 2
+modules:
+  - name: myModule
+    image: myacr.azurecr.io/my-module:dev
+    env:
+      - LOG_LEVEL=debug
+      - HUB=dev
+  - name: mySidecar
+    image: myacr.azurecr.io/my-sidecar:1.0
+deployment:
+  id: my-module
+  priority: 10
+  target-condition: tags.environment='dev'
+infra:
+  hub: dev-hub
+environments:
+  prod:
+    modules:
+      - name: myModule
+        image: myacr.azurecr.io/my-module:1.0
+        env:
+          - LOG_LEVEL=info
+      - name: myMonitor
+        image: myacr.azurecr.io/my-monitor:1.0
+    deployment:
+      priority: 100
+      target-condition: tags.environment='prod'
+    infra:
+      hub: prod-hub
+`
+
+	raw, _, err := configuration.Decode([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := configuration.ApplyEnvironment(raw, "prod"); err != nil {
+		t.Fatal(err)
+	}
+
+	modules := raw["modules"].([]interface{})
+	if len(modules) != 3 {
+		t.Fatalf("expected 3 modules got %d", len(modules))
+	}
+
+	main := modules[0].(map[string]interface{})
+	if main["image"] != "myacr.azurecr.io/my-module:1.0" {
+		t.Errorf("expected the prod image got %v", main["image"])
+	}
+
+	expectedEnv := []interface{}{"LOG_LEVEL=info", "HUB=dev"}
+	if !reflect.DeepEqual(main["env"], expectedEnv) {
+		t.Errorf("expected env %v got %v", expectedEnv, main["env"])
+	}
+
+	if modules[2].(map[string]interface{})["name"] != "myMonitor" {
+		t.Errorf("expected the environment module to be appended, got %v", modules[2])
+	}
+
+	deployment := raw["deployment"].(map[string]interface{})
+	if deployment["id"] != "my-module" || deployment["priority"] != 100 || deployment["target-condition"] != "tags.environment='prod'" {
+		t.Errorf("unexpected deployment %v", deployment)
+	}
+
+	if raw["infra"].(map[string]interface{})["hub"] != "prod-hub" {
+		t.Errorf("expected the prod hub got %v", raw["infra"])
+	}
+
+	if err := configuration.ApplyEnvironment(raw, "staging"); err == nil {
+		t.Error("expected an error for an unknown environment")
+	}
+}
@@ -0,0 +1,22 @@
+package configuration
+
+import "fmt"
+
+type UnsupportedVersionError struct {
+	Version int
+}
+
+// Implement the error interface
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("configuration version %d is not supported by this client (up to version %d), please upgrade elcli", e.Version, CONFIG_VERSION)
+}
+
+// ConfigNotFoundError is returned when no configuration file is found in a directory nor in its parents.
+type ConfigNotFoundError struct {
+	Dir string
+}
+
+// Implement the error interface
+func (e *ConfigNotFoundError) Error() string {
+	return fmt.Sprintf("no %s found in %s or any of its parent directories", CONFIG_FILE_NAME, e.Dir)
+}
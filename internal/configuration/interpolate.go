@@ -0,0 +1,247 @@
+package configuration
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/unbrikd/edge-leap/internal/utils"
+)
+
+// REDACTED is the text secret values are replaced with in any output.
+const REDACTED = "******"
+
+// variableRegexp matches the ${NAME}, ${NAME:-default} and ${NAME-default} variables, and the $${ escape sequence.
+var variableRegexp = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:?-)([^}]*))?\}`)
+
+// secretKeys holds the paths of the configuration values always treated as secrets.
+var secretKeys = map[string]bool{
+	"auth.token":            true,
+	"infra.hubs[].token":    true,
+	"registries[].password": true,
+	"registries[].token":    true,
+}
+
+// Resolve resolves in place the variables and references of a raw configuration and returns the secret values found.
+// Strings can hold ${NAME} variables, replaced by the value of the environment variable NAME (an error is returned if
+// it is not set), ${NAME:-default} (default used if NAME is unset or empty) and ${NAME-default} (default used if NAME is
+// unset). A whole value, or the value of a module environment variable, can also be a reference: env:NAME is replaced by
+// the value of the environment variable NAME and file:/path by the content of the file. Referenced values and the
+// values of the secret keys (e.g. auth.token) are secrets. The environments overlays are left untouched.
+func Resolve(raw map[string]interface{}) ([]string, error) {
+	r := resolver{secrets: map[string]bool{}}
+
+	for k, v := range raw {
+		if k == "environments" {
+			continue
+		}
+
+		resolved, err := r.resolve(k, k, v)
+		if err != nil {
+			return nil, err
+		}
+		raw[k] = resolved
+	}
+
+	secrets := []string{}
+	for s := range r.secrets {
+		secrets = append(secrets, s)
+	}
+
+	return secrets, nil
+}
+
+// ResolveKnown resolves in place the variables and references of a raw configuration like Resolve, except the values
+// that cannot be resolved yet (e.g. a variable that is not set) are set to nil instead of failing. The paths of these
+// values (e.g. modules[0].env[1]) are returned.
+func ResolveKnown(raw map[string]interface{}) []string {
+	r := resolver{secrets: map[string]bool{}, lenient: true}
+
+	for k, v := range raw {
+		if k == "environments" {
+			continue
+		}
+
+		resolved, _ := r.resolve(k, k, v)
+		raw[k] = resolved
+	}
+
+	return r.unresolved
+}
+
+// resolver resolves the values of a raw configuration, collecting the secret values along the way. A lenient resolver
+// sets the values it cannot resolve to nil and collects their paths instead of failing.
+type resolver struct {
+	secrets    map[string]bool
+	lenient    bool
+	unresolved []string
+}
+
+// resolve resolves a value found at the given path. The schema path (e.g. registries[].token) identifies the secret keys.
+func (r *resolver) resolve(path, schemaPath string, v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			resolved, err := r.resolve(fmt.Sprintf("%s.%s", path, k), fmt.Sprintf("%s.%s", schemaPath, k), item)
+			if err != nil {
+				return nil, err
+			}
+			val[k] = resolved
+		}
+		return val, nil
+	case []interface{}:
+		for i, item := range val {
+			resolved, err := r.resolve(fmt.Sprintf("%s[%d]", path, i), schemaPath+"[]", item)
+			if err != nil {
+				return nil, err
+			}
+			val[i] = resolved
+		}
+		return val, nil
+	case string:
+		s, err := r.resolveString(path, schemaPath, val)
+		if err != nil && r.lenient {
+			r.unresolved = append(r.unresolved, path)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if secretKeys[schemaPath] && s != "" {
+			r.secrets[s] = true
+		}
+		return s, nil
+	}
+
+	return v, nil
+}
+
+// resolveString resolves the variables and references of a string value.
+func (r *resolver) resolveString(path, schemaPath, s string) (string, error) {
+	var expandErr error
+	s = variableRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$${" {
+			return "${"
+		}
+
+		sub := variableRegexp.FindStringSubmatch(m)
+		name, op, fallback := sub[1], sub[2], sub[3]
+
+		value, set := os.LookupEnv(name)
+		switch {
+		case op == "-":
+			return utils.GetEnv(name, fallback)
+		case op == ":-" && value == "":
+			return fallback
+		case !set:
+			expandErr = fmt.Errorf("%s: environment variable %s is not set", path, name)
+		}
+
+		return value
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+
+	// module environment variables hold the reference in their value (e.g. KEY=file:/run/secrets/key)
+	if strings.HasSuffix(schemaPath, ".env[]") {
+		if k, v, found := strings.Cut(s, "="); found {
+			resolved, err := r.resolveReference(path, v)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s=%s", k, resolved), nil
+		}
+	}
+
+	return r.resolveReference(path, s)
+}
+
+// resolveReference resolves an env:NAME or file:/path reference, other values are returned untouched.
+func (r *resolver) resolveReference(path, s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, "env:"):
+		name := strings.TrimPrefix(s, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%s: environment variable %s is not set", path, name)
+		}
+		r.addSecret(value)
+		return value, nil
+	case strings.HasPrefix(s, "file:"):
+		b, err := os.ReadFile(strings.TrimPrefix(s, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", path, err)
+		}
+		value := strings.TrimRight(string(b), "\r\n")
+		r.addSecret(value)
+		return value, nil
+	}
+
+	return s, nil
+}
+
+// addSecret records a secret value.
+func (r *resolver) addSecret(s string) {
+	if s != "" {
+		r.secrets[s] = true
+	}
+}
+
+// Redactor replaces secret values with REDACTED.
+type Redactor struct {
+	secrets []string
+}
+
+// NewRedactor returns a redactor for the given secret values.
+func NewRedactor(secrets []string) *Redactor {
+	r := &Redactor{}
+	r.Add(secrets...)
+	return r
+}
+
+// Add adds secret values to the redactor, empty values are ignored.
+func (r *Redactor) Add(secrets ...string) {
+	for _, s := range secrets {
+		if s != "" {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+
+	// longer secrets first, so a secret containing another one is fully redacted
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+// Redact returns the string with every secret value replaced.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, REDACTED)
+	}
+
+	return s
+}
+
+// RedactRaw replaces in place the secret values of a raw configuration.
+func (r *Redactor) RedactRaw(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = r.RedactRaw(item)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = r.RedactRaw(item)
+		}
+	case string:
+		return r.Redact(val)
+	}
+
+	return v
+}
@@ -0,0 +1,127 @@
+package configuration_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("ELCLI_TEST_HUB", "my-hub")
+	t.Setenv("ELCLI_TEST_EMPTY", "")
+	t.Setenv("ELCLI_TEST_TOKEN", "SharedAccessSignature sr=x&sig=y")
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("c2VjcmV0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	content := `
+version: 2
+modules:
+  - name: myModule
+    image: myacr.azurecr.io/my-module:${ELCLI_TEST_TAG:-latest}
+    env:
+      - HUB=${ELCLI_TEST_HUB}
+      - KEY=file:` + keyFile + `
+      - LITERAL=$${NOT_A_VARIABLE}
+      - EMPTY=${ELCLI_TEST_EMPTY-unused}
+registries:
+  - username: user
+    password: registry-password
+infra:
+  hub: ${ELCLI_TEST_HUB}
+auth:
+  token: env:ELCLI_TEST_TOKEN
+environments:
+  prod:
+    infra:
+      hub: ${ELCLI_TEST_UNSET}
+`
+
+	raw, _, err := configuration.Decode([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secrets, err := configuration.Resolve(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	module := raw["modules"].([]interface{})[0].(map[string]interface{})
+	if module["image"] != "myacr.azurecr.io/my-module:latest" {
+		t.Errorf("unexpected image %v", module["image"])
+	}
+
+	expectedEnv := []string{"HUB=my-hub", "KEY=c2VjcmV0", "LITERAL=${NOT_A_VARIABLE}", "EMPTY="}
+	for i, e := range expectedEnv {
+		if module["env"].([]interface{})[i] != e {
+			t.Errorf("expected '%s' got '%v'", e, module["env"].([]interface{})[i])
+		}
+	}
+
+	if raw["auth"].(map[string]interface{})["token"] != "SharedAccessSignature sr=x&sig=y" {
+		t.Errorf("unexpected token %v", raw["auth"])
+	}
+
+	sort.Strings(secrets)
+	expectedSecrets := []string{"SharedAccessSignature sr=x&sig=y", "c2VjcmV0", "registry-password"}
+	if len(secrets) != len(expectedSecrets) {
+		t.Fatalf("expected secrets %v got %v", expectedSecrets, secrets)
+	}
+
+	for i, s := range expectedSecrets {
+		if secrets[i] != s {
+			t.Errorf("expected secret '%s' got '%s'", s, secrets[i])
+		}
+	}
+
+	r := configuration.NewRedactor(secrets)
+	if got := r.Redact("token: SharedAccessSignature sr=x&sig=y, key: c2VjcmV0"); got != "token: ******, key: ******" {
+		t.Errorf("unexpected redacted output '%s'", got)
+	}
+
+	raw, _, _ = configuration.Decode([]byte("infra:\n  hub: ${ELCLI_TEST_UNSET}\n"))
+	if _, err := configuration.Resolve(raw); err == nil {
+		t.Error("expected an error for an unset variable")
+	}
+}
+
+func TestResolveKnown(t *testing.T) {
+	t.Setenv("ELCLI_TEST_HUB", "my-hub")
+
+	content := `
+modules:
+  - name: myModule
+    image: ${ELCLI_TEST_UNSET}/my-module:1.0
+    env:
+      - HUB=${ELCLI_TEST_HUB}
+      - KEY=env:ELCLI_TEST_UNSET
+infra:
+  hub: ${ELCLI_TEST_HUB}
+`
+
+	raw, _, err := configuration.Decode([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unresolved := configuration.ResolveKnown(raw)
+	sort.Strings(unresolved)
+	if expected := []string{"modules[0].env[1]", "modules[0].image"}; len(unresolved) != 2 || unresolved[0] != expected[0] || unresolved[1] != expected[1] {
+		t.Fatalf("expected %v to be unresolved, got %v", expected, unresolved)
+	}
+
+	module := raw["modules"].([]interface{})[0].(map[string]interface{})
+	if module["image"] != nil || module["env"].([]interface{})[0] != "HUB=my-hub" || module["env"].([]interface{})[1] != nil {
+		t.Errorf("expected only the unresolved values to be cleared, got %v", module)
+	}
+
+	if raw["infra"].(map[string]interface{})["hub"] != "my-hub" {
+		t.Errorf("unexpected hub %v", raw["infra"])
+	}
+}
@@ -0,0 +1,164 @@
+package configuration
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// migrations holds the functions upgrading a raw configuration from a version to the next one, by source version.
+var migrations = map[int]func(map[string]interface{}) error{
+	1: migrateV1ToV2,
+}
+
+// Decode decodes the content of a configuration file into a raw configuration and migrates it to CONFIG_VERSION. The
+// version the configuration was written with is returned along with it. An empty content is a valid configuration.
+func Decode(b []byte) (map[string]interface{}, int, error) {
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, 0, err
+	}
+
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+
+	version, err := Migrate(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return raw, version, nil
+}
+
+// Encode encodes a raw configuration in the configuration file format.
+func Encode(raw map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(raw); err != nil {
+		return nil, err
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Raw returns the configuration as a raw configuration, in the form of the configuration files. The values left empty
+// are omitted.
+func (c *Configuration) Raw() map[string]interface{} {
+	raw, _ := rawValue(reflect.ValueOf(*c)).(map[string]interface{})
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+
+	return raw
+}
+
+// rawValue returns a value of the configuration in its raw form, nil if it is empty.
+func rawValue(v reflect.Value) interface{} {
+	if v.IsZero() {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		m := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+			if name == "" || name == "-" || !f.IsExported() {
+				continue
+			}
+
+			if item := rawValue(v.Field(i)); item != nil {
+				m[name] = item
+			}
+		}
+
+		if len(m) == 0 {
+			return nil
+		}
+		return m
+	case reflect.Slice:
+		l := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			l = append(l, rawValue(v.Index(i)))
+		}
+		return l
+	case reflect.Map:
+		m := map[string]interface{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = rawValue(iter.Value())
+		}
+		return m
+	}
+
+	return v.Interface()
+}
+
+// Migrate upgrades a raw configuration in place to CONFIG_VERSION and returns the version it was written with.
+// Configurations without version are considered to be version 1, the version written by the first releases.
+func Migrate(raw map[string]interface{}) (int, error) {
+	version := 1
+	if v, ok := raw["version"]; ok && v != nil {
+		i, ok := v.(int)
+		if !ok {
+			return 0, fmt.Errorf("invalid configuration version: %v", v)
+		}
+		version = i
+	}
+
+	if version < 1 {
+		return 0, fmt.Errorf("invalid configuration version: %d", version)
+	}
+
+	if version > CONFIG_VERSION {
+		return 0, &UnsupportedVersionError{Version: version}
+	}
+
+	for v := version; v < CONFIG_VERSION; v++ {
+		if err := migrations[v](raw); err != nil {
+			return 0, fmt.Errorf("failed to migrate configuration from version %d to %d: %v", v, v+1, err)
+		}
+		raw["version"] = v + 1
+	}
+
+	return version, nil
+}
+
+// migrateV1ToV2 turns the single module of a version 1 configuration into the modules list, and the single registry
+// into the registries list. The version 1 registry credentials applied to any registry, so no server is set.
+func migrateV1ToV2(raw map[string]interface{}) error {
+	if m, ok := raw["module"]; ok {
+		delete(raw, "module")
+
+		if m != nil {
+			if _, ok := m.(map[string]interface{}); !ok {
+				return fmt.Errorf("module must be a mapping")
+			}
+			raw["modules"] = []interface{}{m}
+		}
+	}
+
+	if r, ok := raw["registry"]; ok {
+		delete(raw, "registry")
+
+		if r != nil {
+			if _, ok := r.(map[string]interface{}); !ok {
+				return fmt.Errorf("registry must be a mapping")
+			}
+			raw["registries"] = []interface{}{r}
+		}
+	}
+
+	return nil
+}
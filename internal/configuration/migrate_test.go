@@ -0,0 +1,161 @@
+package configuration_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+func TestDecodeV1(t *testing.T) {
+	v1 := `
+session: abc
+version: 1
+module:
+  name: myModule
+  image: myacr.azurecr.io/module:1.0
+  env:
+    - KEY=VALUE
+registry:
+  username: user
+  password: secret
+deployment:
+  id: my-module
+`
+
+	raw, version, err := configuration.Decode([]byte(v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != 1 {
+		t.Errorf("expected version 1 got %d", version)
+	}
+
+	if raw["version"] != configuration.CONFIG_VERSION {
+		t.Errorf("expected migrated version %d got %v", configuration.CONFIG_VERSION, raw["version"])
+	}
+
+	if _, ok := raw["module"]; ok {
+		t.Error("migrated configuration still has the 'module' key")
+	}
+
+	modules, ok := raw["modules"].([]interface{})
+	if !ok || len(modules) != 1 {
+		t.Fatalf("expected a single module got %v", raw["modules"])
+	}
+
+	if modules[0].(map[string]interface{})["name"] != "myModule" {
+		t.Errorf("expected module 'myModule' got %v", modules[0])
+	}
+
+	registries, ok := raw["registries"].([]interface{})
+	if !ok || len(registries) != 1 {
+		t.Fatalf("expected a single registry got %v", raw["registries"])
+	}
+
+	if raw["deployment"].(map[string]interface{})["id"] != "my-module" {
+		t.Error("migrated configuration lost the deployment section")
+	}
+}
+
+func TestDecodeVersions(t *testing.T) {
+	for _, content := range []string{"", "session: abc\n"} {
+		_, version, err := configuration.Decode([]byte(content))
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", content, err)
+		}
+
+		if version != 1 {
+			t.Errorf("expected configuration without version to be version 1, got %d", version)
+		}
+	}
+
+	_, version, err := configuration.Decode([]byte("version: 2\nmodules:\n  - name: myModule\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != 2 {
+		t.Errorf("expected version 2 got %d", version)
+	}
+
+	var unsupported *configuration.UnsupportedVersionError
+	if _, _, err := configuration.Decode([]byte("version: 99\n")); !errors.As(err, &unsupported) {
+		t.Errorf("expected an unsupported version error got %v", err)
+	}
+
+	if _, _, err := configuration.Decode([]byte("version: two\n")); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+}
+
+func TestRaw(t *testing.T) {
+	// load decodes a configuration file like the commands do
+	load := func(b []byte) configuration.Configuration {
+		raw, _, err := configuration.Decode(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		configuration.Normalize(raw)
+
+		if b, err = configuration.Encode(raw); err != nil {
+			t.Fatal(err)
+		}
+
+		v := viper.New()
+		v.SetConfigType("yaml")
+		if err := v.ReadConfig(bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+
+		c := configuration.Configuration{}
+		if err := v.Unmarshal(&c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	c := load([]byte(`
+version: 2
+session: abc
+modules:
+  - name: myModule
+    image: myacr.azurecr.io/my-module:1.0
+    startup-order: 1
+    env:
+      - LOG_LEVEL=debug
+routes:
+  upstream: FROM /messages/* INTO $upstream
+deployment:
+  id: my-module
+  priority: 10
+  metrics:
+    running: SELECT deviceId FROM devices
+rollout:
+  steps:
+    - percent: 10
+  health:
+    timeout: 30m
+infra:
+  hubs:
+    - name: eu-hub
+`))
+
+	raw := c.Raw()
+	if _, ok := raw["build"]; ok {
+		t.Errorf("expected the empty build section to be omitted, got %v", raw["build"])
+	}
+
+	b, err := configuration.Encode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reloaded := load(b); !reflect.DeepEqual(reloaded, c) {
+		t.Errorf("expected the raw configuration to load the same configuration\n%+v\ngot\n%+v", c, reloaded)
+	}
+}
@@ -0,0 +1,102 @@
+package configuration
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Normalize converts in place the mappings of a raw configuration whose keys are case sensitive into lists, since
+// configuration keys are case insensitive: the modules environment variables (see NormalizeEnv) and the deployment
+// metrics (see NormalizeMetrics).
+func Normalize(raw map[string]interface{}) {
+	NormalizeEnv(raw)
+	NormalizeMetrics(raw)
+}
+
+// NormalizeEnv converts in place the modules environment variables written in the mapping form (KEY: VALUE) into the
+// list form (KEY=VALUE), the keys being sorted. The modules of the environments overlays are converted as well. The
+// conversion happens on the raw configuration since configuration keys are case insensitive, while variable names are
+// not.
+func NormalizeEnv(raw map[string]interface{}) {
+	normalizeModulesEnv(raw["modules"])
+
+	environments, _ := raw["environments"].(map[string]interface{})
+	for _, e := range environments {
+		if overlay, ok := e.(map[string]interface{}); ok {
+			normalizeModulesEnv(overlay["modules"])
+		}
+	}
+}
+
+// normalizeModulesEnv converts the environment variables of a raw modules list into the list form.
+func normalizeModulesEnv(modules interface{}) {
+	list, _ := modules.([]interface{})
+	for _, m := range list {
+		module, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		env, ok := module["env"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		keys := []string{}
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		pairs := []interface{}{}
+		for _, k := range keys {
+			v := env[k]
+			if v == nil {
+				v = ""
+			}
+			pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+		}
+
+		module["env"] = pairs
+	}
+}
+
+// NormalizeMetrics converts in place the deployment metrics written in the mapping form (name: query) into the list
+// form (name and query items), the metrics being sorted by name. The deployment of the environments overlays is
+// converted as well.
+func NormalizeMetrics(raw map[string]interface{}) {
+	normalizeDeploymentMetrics(raw["deployment"])
+
+	environments, _ := raw["environments"].(map[string]interface{})
+	for _, e := range environments {
+		if overlay, ok := e.(map[string]interface{}); ok {
+			normalizeDeploymentMetrics(overlay["deployment"])
+		}
+	}
+}
+
+// normalizeDeploymentMetrics converts the metrics of a raw deployment into the list form.
+func normalizeDeploymentMetrics(deployment interface{}) {
+	d, ok := deployment.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	metrics, ok := d["metrics"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	names := []string{}
+	for k := range metrics {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	list := []interface{}{}
+	for _, name := range names {
+		list = append(list, map[string]interface{}{"name": name, "query": metrics[name]})
+	}
+
+	d["metrics"] = list
+}
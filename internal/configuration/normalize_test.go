@@ -0,0 +1,107 @@
+package configuration_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+func TestNormalizeEnv(t *testing.T) {
+	raw, _, err := configuration.Decode([]byte(`
+version: 2
+modules:
+  - name: myModule
+    env:
+      LOG_LEVEL: debug
+      Port: 8080
+      EMPTY:
+  - name: otherModule
+    env:
+      - A=1
+environments:
+  prod:
+    modules:
+      - name: myModule
+        env:
+          LOG_LEVEL: info
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configuration.NormalizeEnv(raw)
+
+	modules := raw["modules"].([]interface{})
+	expected := []interface{}{"EMPTY=", "LOG_LEVEL=debug", "Port=8080"}
+	if env := modules[0].(map[string]interface{})["env"]; !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %v, got %v", expected, env)
+	}
+
+	expected = []interface{}{"A=1"}
+	if env := modules[1].(map[string]interface{})["env"]; !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %v, got %v", expected, env)
+	}
+
+	if err := configuration.ApplyEnvironment(raw, "prod"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []interface{}{"EMPTY=", "LOG_LEVEL=info", "Port=8080"}
+	if env := raw["modules"].([]interface{})[0].(map[string]interface{})["env"]; !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %v, got %v", expected, env)
+	}
+}
+
+func TestNormalizeMetrics(t *testing.T) {
+	raw, _, err := configuration.Decode([]byte(`
+version: 2
+deployment:
+  id: my-module
+  metrics:
+    modulesRunning: SELECT deviceId FROM devices.modules WHERE moduleId = '$edgeAgent'
+    expectedVersion: SELECT deviceId FROM devices WHERE properties.reported.version = '1.0'
+environments:
+  prod:
+    deployment:
+      metrics:
+        expectedVersion: SELECT deviceId FROM devices WHERE properties.reported.version = '2.0'
+        prodDevices: SELECT deviceId FROM devices WHERE tags.environment = 'prod'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configuration.Normalize(raw)
+	if err := configuration.ApplyEnvironment(raw, "prod"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the configuration is loaded like the commands do, viper lowercasing the keys of the mappings
+	b, err := configuration.Encode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	c := configuration.Configuration{}
+	if err := v.Unmarshal(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []configuration.Metric{
+		{Name: "expectedVersion", Query: "SELECT deviceId FROM devices WHERE properties.reported.version = '2.0'"},
+		{Name: "modulesRunning", Query: "SELECT deviceId FROM devices.modules WHERE moduleId = '$edgeAgent'"},
+		{Name: "prodDevices", Query: "SELECT deviceId FROM devices WHERE tags.environment = 'prod'"},
+	}
+	if !reflect.DeepEqual(c.Deployment.Metrics, expected) {
+		t.Errorf("expected %v, got %v", expected, c.Deployment.Metrics)
+	}
+}
@@ -0,0 +1,134 @@
+package configuration
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// JSON_SCHEMA_ID is the identifier of the configuration JSON Schema.
+const JSON_SCHEMA_ID = "https://raw.githubusercontent.com/unbrikd/edge-leap/main/docs/configuration-schema-v2.json"
+
+// durationPattern matches the durations of the configuration, e.g. 1h30m.
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// metricPattern matches the queries of the deployment metrics.
+const metricPattern = `^\s*[Ss][Ee][Ll][Ee][Cc][Tt]\s+.+\s+[Ff][Rr][Oo][Mm]\s+devices`
+
+// schemaHints holds the constraints and descriptions added to the generated JSON Schema, by path. List items are
+// referenced with [] (e.g. modules[].name) and map values with * (e.g. routes.*).
+var schemaHints = map[string]map[string]interface{}{
+	"session":                     {"description": "Draft session identifier, generated by elcli draft new"},
+	"version":                     {"description": "Configuration schema version", "minimum": 1, "maximum": CONFIG_VERSION},
+	"previous-sessions":           {"description": "Ids of the former draft sessions, recorded by elcli draft new --rotate"},
+	"modules":                     {"description": "Modules to deploy, the first one is the main module handled by the draft commands"},
+	"modules[].name":              {"description": "Name of the module", "pattern": camelCaseRegexp.String()},
+	"modules[].image":             {"description": "Docker image reference"},
+	"modules[].create-options":    {"description": "Docker container creation options in JSON format"},
+	"modules[].startup-order":     {"description": "Startup sequence priority", "minimum": 0},
+	"modules[].env":               {"description": "Environment variables, as a list of KEY=VALUE or a KEY: VALUE mapping", "type": []string{"array", "object"}, "additionalProperties": map[string]interface{}{"type": []string{"string", "number", "boolean", "null"}}, "propertyNames": map[string]interface{}{"pattern": envKeyRegexp.String()}},
+	"modules[].env[]":             {"description": "Environment variable in the KEY=VALUE form", "pattern": `^[A-Za-z_][A-Za-z0-9_]*=`},
+	"routes":                      {"description": "Edge hub routes by route name"},
+	"routes.*":                    {"pattern": `^\s*[Ff][Rr][Oo][Mm]\s+\S+.*\s+[Ii][Nn][Tt][Oo]\s+\S+`},
+	"registries":                  {"description": "Container registries credentials"},
+	"registries[].server":         {"description": "Registry host the credentials apply to, any registry when empty"},
+	"rollout":                     {"description": "Staged rollout plan of the releases"},
+	"rollout.ring-tag":            {"description": "Twin tag naming the ring of the devices, e.g. ring for tags.ring"},
+	"rollout.steps":               {"description": "Steps of the rollout, the whole target is released once the last step is healthy"},
+	"rollout.steps[].percent":     {"description": "Percentage of the target devices of the step", "minimum": 1, "maximum": 100},
+	"rollout.steps[].ring":        {"description": "Ring added to the rings of the previous steps"},
+	"rollout.steps[].wait":        {"description": "Minimum duration the devices run the release before the next step, e.g. 10m", "pattern": durationPattern},
+	"rollout.health.min-healthy":  {"description": "Percentage of the devices of a step which must run the release", "minimum": 0, "maximum": 100},
+	"rollout.health.max-failed":   {"description": "Number of failed devices aborting the rollout", "minimum": 0},
+	"rollout.health.timeout":      {"description": "Duration after which an unhealthy step is aborted, e.g. 30m", "pattern": durationPattern},
+	"rollout.health.interval":     {"description": "Duration between two health checks, e.g. 30s", "pattern": durationPattern},
+	"environments":                {"description": "Named overlays of the configuration"},
+	"build":                       {"description": "Main module image build configuration"},
+	"build.tag":                   {"description": "Image tag template, the session id is available as {{ .Session }}"},
+	"build.platforms[]":           {"pattern": `^[^/]+/[^/]+(/[^/]+)?$`},
+	"deployment":                  {"description": "Deployment configuration"},
+	"deployment.id":               {"description": "Unique identifier for the deployment", "pattern": kebabCaseRegexp.String()},
+	"deployment.priority":         {"description": "Deployment priority level", "minimum": 0, "maximum": 32767},
+	"deployment.target-condition": {"description": "Condition for deployment targeting"},
+	"deployment.metrics":          {"description": "Custom metrics of the deployment, as a name: query mapping or a list of name and query", "type": []string{"array", "object"}, "additionalProperties": map[string]interface{}{"type": "string", "pattern": metricPattern}, "propertyNames": map[string]interface{}{"pattern": camelCaseRegexp.String()}},
+	"deployment.metrics[].name":   {"description": "Name of the metric", "pattern": camelCaseRegexp.String()},
+	"deployment.metrics[].query":  {"description": "Query counting the devices", "pattern": metricPattern},
+	"device":                      {"description": "Development device"},
+	"device.name":                 {"description": "Unique device identifier in the IoT Hub"},
+	"device.platform":             {"description": "Platform of the device, e.g. linux/arm64", "pattern": `^[^/]+/[^/]+(/[^/]+)?$`},
+	"device.strategy":             {"description": "How the drafts are deployed to the device", "enum": []string{STRATEGY_DEPLOYMENT, STRATEGY_DIRECT}},
+	"infra":                       {"description": "Infrastructure configuration"},
+	"infra.hub":                   {"description": "Name of the IoT Hub"},
+	"infra.hubs":                  {"description": "IoT Hubs the releases are sent to, instead of the hub"},
+	"infra.hubs[].name":           {"description": "Name of the IoT Hub"},
+	"infra.hubs[].token":          {"description": "Token to authenticate against the hub, defaults to auth.token"},
+	"auth":                        {"description": "Authentication credentials"},
+	"auth.token":                  {"description": "Shared Access Signature (SAS) token for authentication"},
+}
+
+// JSONSchema returns the JSON Schema of the configuration file, generated from the Configuration structure. It can be
+// used by editors to validate and complete configuration files.
+func JSONSchema() map[string]interface{} {
+	s := schemaFor(reflect.TypeOf(Configuration{}), "")
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["$id"] = JSON_SCHEMA_ID
+	s["title"] = fmt.Sprintf("Edge Leap configuration v%d", CONFIG_VERSION)
+
+	return s
+}
+
+// schemaFor returns the JSON Schema of a type found at the given path.
+func schemaFor(t reflect.Type, path string) map[string]interface{} {
+	s := map[string]interface{}{}
+
+	switch t.Kind() {
+	case reflect.String:
+		s["type"] = "string"
+	case reflect.Bool:
+		s["type"] = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s["type"] = "integer"
+	case reflect.Slice:
+		s["type"] = "array"
+		s["items"] = schemaFor(t.Elem(), path+"[]")
+	case reflect.Map:
+		s["type"] = "object"
+		if t.Elem().Kind() == reflect.Interface {
+			s["additionalProperties"] = map[string]interface{}{"type": "object"}
+		} else {
+			s["additionalProperties"] = schemaFor(t.Elem(), joinPath(path, "*"))
+		}
+	case reflect.Interface:
+		s["type"] = "object"
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+			if name == "" || name == "-" || !f.IsExported() {
+				continue
+			}
+
+			props[name] = schemaFor(f.Type, joinPath(path, name))
+		}
+
+		s["type"] = "object"
+		s["properties"] = props
+		s["additionalProperties"] = false
+	}
+
+	for k, v := range schemaHints[path] {
+		s[k] = v
+	}
+
+	return s
+}
+
+// joinPath joins a schema path and a key.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return fmt.Sprintf("%s.%s", path, key)
+}
@@ -0,0 +1,86 @@
+package configuration
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RotateSession replaces the session id of a configuration file content with a new one and records the previous id in
+// previous-sessions, so the resources of former sessions can be cleaned up later. The content is edited as a YAML
+// document: comments, key ordering and the other settings are preserved. The session is added after the version when
+// the configuration has none. The new content is returned along with the previous session id, empty if there was none.
+func RotateSession(content []byte, id string) ([]byte, string, error) {
+	doc := yaml.Node{}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, "", err
+	}
+
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, "", fmt.Errorf("configuration must be a mapping")
+	}
+
+	previous := ""
+	if n := lookupKey(root, "session"); n != nil {
+		previous = n.Value
+		n.Value = id
+	} else {
+		insertKey(root, "version", "session", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: id})
+	}
+
+	if previous != "" {
+		history := lookupKey(root, "previous-sessions")
+		if history == nil || history.Kind != yaml.SequenceNode {
+			history = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			setKey(root, "previous-sessions", history)
+		}
+		history.Content = append(history.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: previous})
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(&doc); err != nil {
+		return nil, "", err
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), previous, nil
+}
+
+// insertKey inserts a key in a mapping node after the given key, first if it is not found.
+func insertKey(n *yaml.Node, after, key string, value *yaml.Node) {
+	k := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+
+	i := 0
+	for j := 0; j+1 < len(n.Content); j += 2 {
+		if n.Content[j].Value == after {
+			i = j + 2
+			break
+		}
+	}
+
+	n.Content = append(n.Content[:i], append([]*yaml.Node{k, value}, n.Content[i:]...)...)
+}
+
+// setKey sets the value of a key in a mapping node, the key is added last if it is not found.
+func setKey(n *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1] = value
+			return
+		}
+	}
+
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
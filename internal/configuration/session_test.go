@@ -0,0 +1,70 @@
+package configuration_test
+
+import (
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+func TestRotateSession(t *testing.T) {
+	content := `# team configuration
+version: 2
+session: abc123 # current session
+modules:
+  - name: myModule # main module
+    image: nginx:1
+infra:
+  hub: my-hub
+`
+
+	rotated, previous, err := configuration.RotateSession([]byte(content), "def456")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if previous != "abc123" {
+		t.Errorf("expected previous session abc123, got %s", previous)
+	}
+
+	expected := `# team configuration
+version: 2
+session: def456 # current session
+modules:
+  - name: myModule # main module
+    image: nginx:1
+infra:
+  hub: my-hub
+previous-sessions:
+  - abc123
+`
+	if string(rotated) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, rotated)
+	}
+
+	rotated, _, err = configuration.RotateSession(rotated, "0789ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _, err := configuration.Decode(rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := raw["previous-sessions"].([]interface{})
+	if raw["session"] != "0789ab" || len(history) != 2 || history[1] != "def456" {
+		t.Errorf("expected session 0789ab with history [abc123 def456], got %v with %v", raw["session"], history)
+	}
+}
+
+func TestRotateSessionWithoutSession(t *testing.T) {
+	rotated, previous, err := configuration.RotateSession([]byte("version: 2\ninfra:\n  hub: my-hub\n"), "def456")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "version: 2\nsession: def456\ninfra:\n  hub: my-hub\n"
+	if previous != "" || string(rotated) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, rotated)
+	}
+}
@@ -0,0 +1,78 @@
+package configuration
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// templates holds the starter configurations shipped with the client.
+//
+//go:embed templates/*.yaml
+var templates embed.FS
+
+// DEFAULT_TEMPLATE is the name of the template used when none is given.
+const DEFAULT_TEMPLATE = "default"
+
+// UserTemplatesDir returns the directory of the user templates, next to the user configuration file.
+func UserTemplatesDir() string {
+	path := UserConfigFile()
+	if path == "" {
+		return ""
+	}
+
+	return filepath.Join(filepath.Dir(path), "templates")
+}
+
+// Template returns the content of a starter configuration, given by path or by name. Names are looked up in the user
+// templates directory (<name>.yaml), then in the templates shipped with the client. Templates are regular configuration
+// files, shared by a team to start new projects from.
+func Template(nameOrPath string) ([]byte, error) {
+	if strings.ContainsRune(nameOrPath, os.PathSeparator) || filepath.Ext(nameOrPath) != "" {
+		return os.ReadFile(nameOrPath)
+	}
+
+	if dir := UserTemplatesDir(); dir != "" {
+		b, err := os.ReadFile(filepath.Join(dir, nameOrPath+".yaml"))
+		if err == nil || !os.IsNotExist(err) {
+			return b, err
+		}
+	}
+
+	b, err := templates.ReadFile(fmt.Sprintf("templates/%s.yaml", nameOrPath))
+	if err != nil {
+		return nil, fmt.Errorf("unknown template '%s' (available: %s)", nameOrPath, strings.Join(TemplateNames(), ", "))
+	}
+
+	return b, nil
+}
+
+// TemplateNames returns the names of the available templates, the user templates and the templates shipped with the
+// client.
+func TemplateNames() []string {
+	names := map[string]bool{}
+
+	entries, _ := templates.ReadDir("templates")
+	if dir := UserTemplatesDir(); dir != "" {
+		if user, err := os.ReadDir(dir); err == nil {
+			entries = append(entries, user...)
+		}
+	}
+
+	for _, e := range entries {
+		if name, found := strings.CutSuffix(e.Name(), ".yaml"); found && !e.IsDir() {
+			names[name] = true
+		}
+	}
+
+	list := []string{}
+	for n := range names {
+		list = append(list, n)
+	}
+	sort.Strings(list)
+
+	return list
+}
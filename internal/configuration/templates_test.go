@@ -0,0 +1,69 @@
+package configuration_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+func TestTemplate(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	for _, name := range configuration.TemplateNames() {
+		b, err := configuration.Template(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		raw, version, err := configuration.Decode(b)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if version != configuration.CONFIG_VERSION || len(raw["modules"].([]interface{})) != 1 {
+			t.Errorf("%s: expected a version %d template with a single module", name, configuration.CONFIG_VERSION)
+		}
+	}
+
+	if _, err := configuration.Template("unknown"); err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+}
+
+func TestUserTemplate(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	dir := configuration.UserTemplatesDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	team := []byte("version: 2\ninfra:\n  hub: team-hub\n")
+	if err := os.WriteFile(filepath.Join(dir, "team.yaml"), team, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// user templates take precedence over the templates shipped with the client
+	if err := os.WriteFile(filepath.Join(dir, "default.yaml"), team, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"team", "default", filepath.Join(dir, "team.yaml")} {
+		b, err := configuration.Template(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(b, team) {
+			t.Errorf("%s: expected the user template, got %s", name, b)
+		}
+	}
+
+	expected := []string{"build", "default", "team"}
+	if names := configuration.TemplateNames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
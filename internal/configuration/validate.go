@@ -0,0 +1,367 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unbrikd/edge-leap/internal/registry"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// kebabCaseRegexp matches kebab-case identifiers such as deployment ids.
+	kebabCaseRegexp = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+	// camelCaseRegexp matches camelCase identifiers such as module names.
+	camelCaseRegexp = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+	// envKeyRegexp matches environment variable names.
+	envKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// metricRegexp matches the overall shape of a deployment metric query.
+	metricRegexp = regexp.MustCompile(`(?is)^\s*SELECT\s+.+\s+FROM\s+devices(\.modules)?(\s|$)`)
+	// routeRegexp matches the overall shape of an edge hub route.
+	routeRegexp = regexp.MustCompile(`(?is)^\s*FROM\s+\S+.*\s+INTO\s+\S+`)
+)
+
+// ValidationError describes an invalid configuration value. The path is the dotted path of the value in the
+// configuration file (e.g. modules[0].name), line and column are only set when the error has been located in the file.
+type ValidationError struct {
+	Path    string
+	Message string
+	Line    int
+	Column  int
+}
+
+// Implement the error interface
+func (e ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%d:%d: %s: %s", e.Line, e.Column, e.Path, e.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+type ValidationErrors []ValidationError
+
+// Implement the error interface
+func (e ValidationErrors) Error() string {
+	msgs := []string{}
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("invalid configuration:\n  %s", strings.Join(msgs, "\n  "))
+}
+
+// Validate checks the values set in the configuration. Missing values are not reported, since which values are required
+// depends on the command being executed. Nil is returned if the configuration is valid, ValidationErrors otherwise.
+func (c *Configuration) Validate() error {
+	errs := ValidationErrors{}
+	add := func(path, format string, a ...interface{}) {
+		errs = append(errs, ValidationError{Path: path, Message: fmt.Sprintf(format, a...)})
+	}
+
+	names := map[string]bool{}
+	for i, m := range c.Modules {
+		p := fmt.Sprintf("modules[%d]", i)
+
+		if m.Name != "" && !camelCaseRegexp.MatchString(m.Name) {
+			add(p+".name", "module name '%s' must be camelCase", m.Name)
+		}
+
+		if names[m.Name] && m.Name != "" {
+			add(p+".name", "module name '%s' is used by several modules", m.Name)
+		}
+		names[m.Name] = true
+
+		if m.Image != "" {
+			if _, err := registry.ParseReference(m.Image); err != nil {
+				add(p+".image", "%v", err)
+			}
+		}
+
+		if m.CreateOptions != "" {
+			opts := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(m.CreateOptions), &opts); err != nil {
+				add(p+".create-options", "create options must be a JSON object: %v", err)
+			}
+		}
+
+		if m.StartupOrder < 0 {
+			add(p+".startup-order", "startup order must be a positive number")
+		}
+
+		for j, e := range m.Env {
+			k, _, found := strings.Cut(e, "=")
+			if !found {
+				add(fmt.Sprintf("%s.env[%d]", p, j), "environment variable '%s' must be in the KEY=VALUE form", e)
+				continue
+			}
+
+			if !envKeyRegexp.MatchString(k) {
+				add(fmt.Sprintf("%s.env[%d]", p, j), "invalid environment variable name '%s'", k)
+			}
+		}
+	}
+
+	for name, route := range c.Routes {
+		if !routeRegexp.MatchString(route) {
+			add(fmt.Sprintf("routes.%s", name), "route must be in the 'FROM <source> [WHERE <condition>] INTO <sink>' form")
+		}
+	}
+
+	for i, r := range c.Registries {
+		if strings.Contains(r.Server, "://") || strings.Contains(r.Server, "/") {
+			add(fmt.Sprintf("registries[%d].server", i), "registry server '%s' must be a host without scheme nor path", r.Server)
+		}
+	}
+
+	if c.Deployment.Id != "" && !kebabCaseRegexp.MatchString(c.Deployment.Id) {
+		add("deployment.id", "deployment id '%s' must be kebab-case", c.Deployment.Id)
+	}
+
+	if c.Deployment.Priority < 0 {
+		add("deployment.priority", "priority must be between 0 and 32767")
+	}
+
+	if c.Deployment.TargetCondition != "" {
+		if err := checkTargetCondition(c.Deployment.TargetCondition); err != nil {
+			add("deployment.target-condition", "%v", err)
+		}
+	}
+
+	metrics := map[string]bool{}
+	for _, m := range c.Deployment.Metrics {
+		p := fmt.Sprintf("deployment.metrics.%s", m.Name)
+		switch {
+		case !camelCaseRegexp.MatchString(m.Name):
+			add(p, "metric name '%s' must be camelCase", m.Name)
+		case metrics[m.Name]:
+			add(p, "metric '%s' is defined several times", m.Name)
+		}
+		metrics[m.Name] = true
+
+		if !metricRegexp.MatchString(m.Query) {
+			add(p, "metric must be a 'SELECT deviceId FROM devices [WHERE <condition>]' or a devices.modules query")
+		}
+	}
+
+	hubs := map[string]bool{}
+	for i, h := range c.Infra.Hubs {
+		switch {
+		case h.Name == "":
+			add(fmt.Sprintf("infra.hubs[%d].name", i), "hub name is required")
+		case hubs[h.Name]:
+			add(fmt.Sprintf("infra.hubs[%d].name", i), "hub '%s' is listed several times", h.Name)
+		}
+		hubs[h.Name] = true
+	}
+
+	c.Rollout.validate(add)
+
+	// the releases being rolled out are deployed with a priority above the one of the deployment
+	if len(c.Rollout.Steps) > 0 && c.Deployment.Priority == math.MaxInt16 {
+		add("deployment.priority", "priority must be below %d to roll out releases", math.MaxInt16)
+	}
+
+	if c.Device.Platform != "" {
+		if _, err := registry.ParsePlatform(c.Device.Platform); err != nil {
+			add("device.platform", "%v", err)
+		}
+	}
+
+	switch c.Device.Strategy {
+	case "", STRATEGY_DEPLOYMENT, STRATEGY_DIRECT:
+	default:
+		add("device.strategy", "strategy must be %s or %s", STRATEGY_DEPLOYMENT, STRATEGY_DIRECT)
+	}
+
+	for i, p := range c.Build.Platforms {
+		if _, err := registry.ParsePlatform(p); err != nil {
+			add(fmt.Sprintf("build.platforms[%d]", i), "%v", err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// checkTargetCondition checks the target condition quotes and parentheses are balanced.
+func checkTargetCondition(cond string) error {
+	depth := 0
+	var quote rune
+	for _, r := range cond {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("target condition has an unexpected ')'")
+			}
+		}
+	}
+
+	if quote != 0 {
+		return fmt.Errorf("target condition has an unterminated string")
+	}
+
+	if depth != 0 {
+		return fmt.Errorf("target condition has an unclosed '('")
+	}
+
+	return nil
+}
+
+// Locate sets the line and column of the validation errors from the content of the configuration file. When an
+// environment is given, values are first looked up in its overlay. Paths of the current schema are also looked up with
+// their version 1 equivalent (e.g. modules[0] is module in version 1 files).
+func (e ValidationErrors) Locate(content []byte, environment string) {
+	root := yaml.Node{}
+	if err := yaml.Unmarshal(content, &root); err != nil || len(root.Content) == 0 {
+		return
+	}
+
+	for i := range e {
+		var n *yaml.Node
+		if environment != "" {
+			n = lookupNode(root.Content[0], fmt.Sprintf("environments.%s.%s", environment, e[i].Path))
+		}
+
+		if n == nil {
+			n = lookupNode(root.Content[0], e[i].Path)
+		}
+
+		if n == nil {
+			v1 := strings.NewReplacer("modules[0]", "module", "registries[0]", "registry").Replace(e[i].Path)
+			n = lookupNode(root.Content[0], v1)
+		}
+
+		if n != nil {
+			e[i].Line = n.Line
+			e[i].Column = n.Column
+		}
+	}
+}
+
+// lookupNode returns the node of a YAML document at the given path (e.g. modules[0].env[1]), nil if not found.
+func lookupNode(n *yaml.Node, path string) *yaml.Node {
+	for _, segment := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(segment, "[")
+		if key != "" {
+			if n = lookupKey(n, key); n == nil {
+				return nil
+			}
+		}
+
+		for rest != "" {
+			idx, after, found := strings.Cut(rest, "]")
+			if !found {
+				return nil
+			}
+
+			i, err := strconv.Atoi(idx)
+			if err != nil || n.Kind != yaml.SequenceNode || i >= len(n.Content) {
+				return nil
+			}
+
+			n = n.Content[i]
+			rest = strings.TrimPrefix(after, "[")
+		}
+	}
+
+	return n
+}
+
+// lookupKey returns the value node of a key in a mapping node, nil if not found. Keys are compared case insensitively
+// since the configuration keys are case insensitive.
+func lookupKey(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if strings.EqualFold(n.Content[i].Value, key) {
+			return n.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// validate checks the rollout plan, the errors being reported with add.
+func (r *Rollout) validate(add func(path, format string, a ...interface{})) {
+	percent := 0
+	rings := map[string]bool{}
+	for i, s := range r.Steps {
+		p := fmt.Sprintf("rollout.steps[%d]", i)
+
+		switch {
+		case s.Percent != 0 && s.Ring != "":
+			add(p, "a step targets either a percentage of the devices or a ring")
+		case s.Percent != 0:
+			if r.RingTag != "" {
+				add(p+".percent", "steps target rings when ring-tag is set")
+			}
+
+			if s.Percent <= percent || s.Percent > 100 {
+				add(p+".percent", "percentages must increase from one step to the next and be at most 100")
+			}
+			percent = s.Percent
+		case s.Ring != "":
+			if r.RingTag == "" {
+				add(p+".ring", "ring-tag is required to target rings")
+			}
+
+			if rings[s.Ring] {
+				add(p+".ring", "ring '%s' is targeted by several steps", s.Ring)
+			}
+			rings[s.Ring] = true
+		default:
+			if i != len(r.Steps)-1 {
+				add(p, "only the last step can target the whole target, other steps need a percentage or a ring")
+			}
+		}
+
+		checkDuration(add, p+".wait", s.Wait)
+	}
+
+	if r.Health.MinHealthy < 0 || r.Health.MinHealthy > 100 {
+		add("rollout.health.min-healthy", "min-healthy must be a percentage between 0 and 100")
+	}
+
+	if r.Health.MaxFailed < 0 {
+		add("rollout.health.max-failed", "max-failed must be a positive number")
+	}
+
+	checkDuration(add, "rollout.health.timeout", r.Health.Timeout)
+	checkDuration(add, "rollout.health.interval", r.Health.Interval)
+
+	// the health of the devices is polled every interval, a zero interval would flood the hub with queries
+	if v, err := time.ParseDuration(r.Health.Interval); err == nil && v == 0 {
+		add("rollout.health.interval", "interval must be above zero")
+	}
+}
+
+// checkDuration reports a duration which cannot be parsed, empty durations are valid.
+func checkDuration(add func(path, format string, a ...interface{}), path, d string) {
+	if d == "" {
+		return
+	}
+
+	if v, err := time.ParseDuration(d); err != nil || v < 0 {
+		add(path, "invalid duration '%s', expected a duration such as 30s or 10m", d)
+	}
+}
@@ -0,0 +1,171 @@
+package configuration_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/configuration"
+)
+
+func TestValidate(t *testing.T) {
+	c := configuration.Configuration{}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("expected an empty configuration to be valid, got %v", err)
+	}
+
+	c.Modules = []configuration.Module{{
+		Name:          "myModule",
+		Image:         "myacr.azurecr.io/my-module:1.0",
+		CreateOptions: `{"HostConfig":{"Privileged":true}}`,
+		Env:           []string{"KEY=VALUE", "CONN=HostName=x;Key=y=="},
+	}}
+	c.Routes = map[string]string{"upstream": "FROM /messages/* INTO $upstream"}
+	c.Deployment.Id = "my-module"
+	c.Deployment.TargetCondition = "tags.environment='dev' AND (tags.ring='1' OR tags.ring='2')"
+	c.Deployment.Metrics = []configuration.Metric{{Name: "running", Query: "SELECT deviceId FROM devices.modules WHERE moduleId='$edgeAgent' AND properties.reported.modules.myModule.runtimeStatus='running'"}}
+	c.Device.Platform = "linux/arm64"
+	c.Device.Strategy = configuration.STRATEGY_DIRECT
+	if err := c.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got %v", err)
+	}
+
+	c.Modules = append(c.Modules, configuration.Module{
+		Name:          "MyModule",
+		Image:         "My Image",
+		CreateOptions: "{not json",
+		Env:           []string{"1KEY=VALUE", "NOVALUE"},
+	})
+	c.Routes["broken"] = "TO $upstream"
+	c.Deployment.Id = "My_Module"
+	c.Deployment.Priority = -1
+	c.Deployment.TargetCondition = "tags.environment='dev"
+	c.Deployment.Metrics = []configuration.Metric{{Name: "Running", Query: "count the running modules"}, {Name: "running", Query: "SELECT deviceId FROM devices"}, {Name: "running", Query: "SELECT deviceId FROM devices"}}
+	c.Device.Platform = "arm64"
+	c.Device.Strategy = "twin"
+	c.Infra.Hubs = []configuration.Hub{{Name: "eu-hub"}, {Name: "eu-hub"}, {Token: "token"}}
+
+	expected := []string{
+		"modules[1].name",
+		"modules[1].image",
+		"modules[1].create-options",
+		"modules[1].env[0]",
+		"modules[1].env[1]",
+		"routes.broken",
+		"deployment.id",
+		"deployment.priority",
+		"deployment.target-condition",
+		"deployment.metrics.Running",
+		"deployment.metrics.Running",
+		"deployment.metrics.running",
+		"infra.hubs[1].name",
+		"infra.hubs[2].name",
+		"device.platform",
+		"device.strategy",
+	}
+
+	var errs configuration.ValidationErrors
+	if err := c.Validate(); !errors.As(err, &errs) {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors got %d: %v", len(expected), len(errs), errs)
+	}
+
+	for i, path := range expected {
+		if errs[i].Path != path {
+			t.Errorf("expected error %d on '%s' got '%s'", i, path, errs[i].Path)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	content := []byte(`version: 1
+module:
+  name: MyModule
+  env:
+    - KEY=VALUE
+    - 1KEY=VALUE
+deployment:
+  id: My_Module
+`)
+
+	errs := configuration.ValidationErrors{
+		{Path: "modules[0].name"},
+		{Path: "modules[0].env[1]"},
+		{Path: "deployment.id"},
+		{Path: "device.name"},
+	}
+	errs.Locate(content, "")
+
+	expected := [][2]int{{3, 9}, {6, 7}, {8, 7}, {0, 0}}
+	for i, e := range expected {
+		if errs[i].Line != e[0] || errs[i].Column != e[1] {
+			t.Errorf("expected '%s' at %d:%d got %d:%d", errs[i].Path, e[0], e[1], errs[i].Line, errs[i].Column)
+		}
+	}
+}
+
+func TestJSONSchemaUpToDate(t *testing.T) {
+	b, err := json.MarshalIndent(configuration.JSONSchema(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published, err := os.ReadFile("../../docs/configuration-schema-v2.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(append(b, '\n'), published) {
+		t.Error("docs/configuration-schema-v2.json is outdated, regenerate it with: elcli config schema -o docs/configuration-schema-v2.json")
+	}
+}
+
+func TestValidateRollout(t *testing.T) {
+	c := configuration.Configuration{}
+	c.Rollout.Steps = []configuration.RolloutStep{{Percent: 5, Wait: "10m"}, {Percent: 25}, {}}
+	c.Rollout.Health.Timeout = "1h"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("expected a valid rollout, got %v", err)
+	}
+
+	c.Rollout.Steps = []configuration.RolloutStep{{Percent: 25}, {}, {Percent: 5, Ring: "canary", Wait: "soon"}, {Ring: "canary"}}
+	c.Rollout.Health.MinHealthy = 120
+	c.Rollout.Health.Interval = "-1s"
+	c.Deployment.Priority = 32767
+
+	expected := []string{
+		"rollout.steps[1]",
+		"rollout.steps[2]",
+		"rollout.steps[2].wait",
+		"rollout.steps[3].ring",
+		"rollout.health.min-healthy",
+		"rollout.health.interval",
+		"deployment.priority",
+	}
+
+	var errs configuration.ValidationErrors
+	if err := c.Validate(); !errors.As(err, &errs) {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors got %d: %v", len(expected), len(errs), errs)
+	}
+
+	for i, path := range expected {
+		if errs[i].Path != path {
+			t.Errorf("expected error %d on '%s' got '%s'", i, path, errs[i].Path)
+		}
+	}
+
+	c = configuration.Configuration{}
+	c.Rollout.Health.Interval = "0s"
+	if err := c.Validate(); !errors.As(err, &errs) || len(errs) != 1 || errs[0].Path != "rollout.health.interval" {
+		t.Errorf("expected a zero interval to be rejected, got %v", err)
+	}
+}
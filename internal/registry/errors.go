@@ -0,0 +1,22 @@
+package registry
+
+import "fmt"
+
+type ManifestNotFoundError struct {
+	Reference string
+}
+
+// Implement the error interface
+func (e *ManifestNotFoundError) Error() string {
+	return fmt.Sprintf("image '%s' not found in the registry", e.Reference)
+}
+
+type PlatformNotFoundError struct {
+	Reference string
+	Platform  string
+}
+
+// Implement the error interface
+func (e *PlatformNotFoundError) Error() string {
+	return fmt.Sprintf("image '%s' is not available for platform '%s'", e.Reference, e.Platform)
+}
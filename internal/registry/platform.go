@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Platform describes the operating system and architecture an image runs on.
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ParsePlatform parses a platform in the os/arch[/variant] form, e.g. linux/arm64 or linux/arm/v7.
+func ParsePlatform(s string) (*Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid platform '%s', expected os/arch[/variant]", s)
+	}
+
+	p := &Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+
+	return p, nil
+}
+
+// String returns the platform in the os/arch[/variant] form.
+func (p *Platform) String() string {
+	if p.Variant != "" {
+		return fmt.Sprintf("%s/%s/%s", p.OS, p.Architecture, p.Variant)
+	}
+
+	return fmt.Sprintf("%s/%s", p.OS, p.Architecture)
+}
+
+// Matches reports whether the platform satisfies the wanted one. The variant is only compared when the wanted platform
+// declares it.
+func (p *Platform) Matches(wanted *Platform) bool {
+	if p.OS != wanted.OS || p.Architecture != wanted.Architecture {
+		return false
+	}
+
+	return wanted.Variant == "" || p.Variant == wanted.Variant
+}
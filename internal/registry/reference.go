@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DOCKER_HUB_REGISTRY is the registry used for image references without a registry host.
+const DOCKER_HUB_REGISTRY = "docker.io"
+
+// dockerHubAPIHost is the host serving the distribution API of Docker Hub.
+const dockerHubAPIHost = "registry-1.docker.io"
+
+var (
+	// pathComponentRegexp matches a single component of a repository path as defined by the distribution spec.
+	pathComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*$`)
+	// hostRegexp matches a registry host with an optional port.
+	hostRegexp = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)(?:\.(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?))*(?::[0-9]+)?$`)
+	// tagRegexp matches an image tag.
+	tagRegexp = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	// digestRegexp matches a content digest.
+	digestRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+)
+
+// Reference is a parsed image reference such as myregistry.azurecr.io/team/module:1.0 or module@sha256:...
+type Reference struct {
+	// Name is the image name as written in the reference, without tag nor digest.
+	Name string
+	// Registry is the host (and port) of the registry serving the image.
+	Registry string
+	// Repository is the path of the repository in the registry.
+	Repository string
+	// Tag is the tag of the image, empty if the reference only holds a digest.
+	Tag string
+	// Digest is the content digest of the image, empty if the reference is not pinned.
+	Digest string
+}
+
+// ParseReference parses an image reference following the docker conventions: the registry defaults to Docker Hub and
+// official images live under the library namespace. If neither tag nor digest is given the latest tag is assumed.
+func ParseReference(s string) (*Reference, error) {
+	if s == "" {
+		return nil, fmt.Errorf("invalid image reference: empty reference")
+	}
+
+	r := &Reference{}
+	name := s
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		r.Digest = name[i+1:]
+		name = name[:i]
+		if !digestRegexp.MatchString(r.Digest) {
+			return nil, fmt.Errorf("invalid image reference '%s': invalid digest '%s'", s, r.Digest)
+		}
+	}
+
+	// a colon after the last slash separates the tag, a colon before it belongs to the registry host port
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		r.Tag = name[i+1:]
+		name = name[:i]
+		if !tagRegexp.MatchString(r.Tag) {
+			return nil, fmt.Errorf("invalid image reference '%s': invalid tag '%s'", s, r.Tag)
+		}
+	}
+
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+
+	r.Name = name
+	r.Registry = DOCKER_HUB_REGISTRY
+	r.Repository = name
+
+	// the first component is a registry host if it looks like a domain, has a port or is localhost
+	if i := strings.Index(name, "/"); i >= 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			if !hostRegexp.MatchString(first) {
+				return nil, fmt.Errorf("invalid image reference '%s': invalid registry '%s'", s, first)
+			}
+			r.Registry = first
+			r.Repository = name[i+1:]
+		}
+	}
+
+	if r.Registry == DOCKER_HUB_REGISTRY && !strings.Contains(r.Repository, "/") {
+		r.Repository = fmt.Sprintf("library/%s", r.Repository)
+	}
+
+	for _, c := range strings.Split(r.Repository, "/") {
+		if !pathComponentRegexp.MatchString(c) {
+			return nil, fmt.Errorf("invalid image reference '%s': invalid repository name '%s'", s, r.Repository)
+		}
+	}
+
+	return r, nil
+}
+
+// String returns the reference in its canonical written form, keeping the name as originally given.
+func (r *Reference) String() string {
+	s := r.Name
+	if r.Tag != "" {
+		s = fmt.Sprintf("%s:%s", s, r.Tag)
+	}
+
+	if r.Digest != "" {
+		s = fmt.Sprintf("%s@%s", s, r.Digest)
+	}
+
+	return s
+}
+
+// Pinned returns the reference of the image pinned to the given digest, the tag is dropped.
+func (r *Reference) Pinned(digest string) string {
+	return fmt.Sprintf("%s@%s", r.Name, digest)
+}
+
+// apiHost returns the host serving the distribution API for the reference registry.
+func (r *Reference) apiHost() string {
+	if r.Registry == DOCKER_HUB_REGISTRY {
+		return dockerHubAPIHost
+	}
+
+	return r.Registry
+}
+
+// version returns the tag or digest used to query the manifest, the digest taking precedence.
+func (r *Reference) version() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+
+	return r.Tag
+}
@@ -0,0 +1,387 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Media types of the manifests understood by the client.
+const (
+	MEDIA_TYPE_OCI_INDEX       = "application/vnd.oci.image.index.v1+json"
+	MEDIA_TYPE_OCI_MANIFEST    = "application/vnd.oci.image.manifest.v1+json"
+	MEDIA_TYPE_DOCKER_LIST     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MEDIA_TYPE_DOCKER_MANIFEST = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// A Client manages communication with container registries through the OCI distribution API. Registries are selected
+// from the image references, so a single client can talk to several registries sharing the same credentials.
+type Client struct {
+	// HTTP client used to communicate with the registries.
+	client *http.Client
+	// Username and Password are used for basic authentication and to request bearer tokens.
+	Username string
+	Password string
+	// Token is a bearer token sent as is to the registry, it takes precedence over the username and password.
+	Token string
+	// Insecure makes the client use plain HTTP. Registries on localhost are always reached through plain HTTP.
+	Insecure bool
+
+	// tokens caches the bearer tokens obtained from the registries token services, by registry and scope.
+	tokens map[string]string
+	mu     sync.Mutex
+}
+
+// Manifest is an image manifest or an image index (manifest list). Only the fields needed to resolve images are decoded.
+type Manifest struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	MediaType     string `json:"mediaType"`
+	// Manifests is the list of platform specific manifests of an image index.
+	Manifests []Descriptor `json:"manifests,omitempty"`
+	// Config is the descriptor of the image configuration of an image manifest.
+	Config *Descriptor `json:"config,omitempty"`
+}
+
+// Descriptor describes a content addressable blob or manifest.
+type Descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Digest    string    `json:"digest"`
+	Size      int64     `json:"size"`
+	Platform  *Platform `json:"platform,omitempty"`
+}
+
+// IsIndex reports whether the manifest is an image index (manifest list).
+func (m *Manifest) IsIndex() bool {
+	return m.MediaType == MEDIA_TYPE_OCI_INDEX || m.MediaType == MEDIA_TYPE_DOCKER_LIST || (m.MediaType == "" && len(m.Manifests) > 0)
+}
+
+// NewClient returns a new registry client. If a nil httpClient is provided a new http.Client will be used.
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	httpClient2 := *httpClient
+	return &Client{client: &httpClient2, tokens: map[string]string{}}
+}
+
+// WithBasicAuth sets the credentials used to authenticate against the registries.
+func (c *Client) WithBasicAuth(username, password string) *Client {
+	c.Username = username
+	c.Password = password
+	return c
+}
+
+// WithBearerToken sets a bearer token sent as is to the registries.
+func (c *Client) WithBearerToken(token string) *Client {
+	c.Token = token
+	return c
+}
+
+// GetManifest retrieves the manifest of an image, which can either be an image index or a single image manifest.
+// The digest of the manifest is returned along with it.
+func (c *Client) GetManifest(ctx context.Context, ref *Reference) (*Manifest, string, error) {
+	u := c.url(ref, fmt.Sprintf("%s/manifests/%s", ref.Repository, ref.version()))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", strings.Join([]string{MEDIA_TYPE_OCI_INDEX, MEDIA_TYPE_DOCKER_LIST, MEDIA_TYPE_OCI_MANIFEST, MEDIA_TYPE_DOCKER_MANIFEST}, ", "))
+
+	res, err := c.do(req, ref)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, "", &ManifestNotFoundError{Reference: ref.String()}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to get manifest of %s: %s", ref, res.Status)
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	m := new(Manifest)
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, "", fmt.Errorf("failed to decode manifest of %s: %v", ref, err)
+	}
+
+	if m.MediaType == "" {
+		m.MediaType = res.Header.Get("Content-Type")
+	}
+
+	digest := res.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+	}
+
+	return m, digest, nil
+}
+
+// Resolve returns the digest of the manifest an image reference points to. If a platform (e.g. linux/arm64) is given
+// and the reference points to an image index, the digest of the platform specific manifest is returned instead.
+func (c *Client) Resolve(ctx context.Context, ref *Reference, platform string) (string, error) {
+	m, digest, err := c.GetManifest(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+
+	if platform == "" || !m.IsIndex() {
+		return digest, nil
+	}
+
+	p, err := ParsePlatform(platform)
+	if err != nil {
+		return "", err
+	}
+
+	for _, d := range m.Manifests {
+		if d.Platform != nil && d.Platform.Matches(p) {
+			return d.Digest, nil
+		}
+	}
+
+	return "", &PlatformNotFoundError{Reference: ref.String(), Platform: p.String()}
+}
+
+// Platforms returns the platforms an image is available for. For an image index the platforms are read from the
+// manifest descriptors (attestation manifests are skipped), for a single image manifest from the image configuration.
+func (c *Client) Platforms(ctx context.Context, ref *Reference) ([]Platform, error) {
+	m, _, err := c.GetManifest(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	platforms := []Platform{}
+	if m.IsIndex() {
+		for _, d := range m.Manifests {
+			if d.Platform == nil || d.Platform.OS == "unknown" {
+				continue
+			}
+			platforms = append(platforms, *d.Platform)
+		}
+
+		return platforms, nil
+	}
+
+	if m.Config == nil {
+		return nil, fmt.Errorf("manifest of %s has no image configuration", ref)
+	}
+
+	p, err := c.getImageConfigPlatform(ctx, ref, m.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(platforms, *p), nil
+}
+
+// getImageConfigPlatform retrieves the image configuration blob and returns the platform it declares.
+func (c *Client) getImageConfigPlatform(ctx context.Context, ref *Reference, digest string) (*Platform, error) {
+	u := c.url(ref, fmt.Sprintf("%s/blobs/%s", ref.Repository, digest))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(req, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get image configuration of %s: %s", ref, res.Status)
+	}
+
+	p := new(Platform)
+	if err := json.NewDecoder(res.Body).Decode(p); err != nil {
+		return nil, fmt.Errorf("failed to decode image configuration of %s: %v", ref, err)
+	}
+
+	return p, nil
+}
+
+// url builds the URL of a distribution API endpoint for the registry of the reference.
+func (c *Client) url(ref *Reference, p string) string {
+	scheme := "https"
+	if c.Insecure || isLocalhost(ref.Registry) {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s/v2/%s", scheme, ref.apiHost(), p)
+}
+
+// do sends a request to a registry, authenticating it when the registry challenges the client. Bearer tokens obtained
+// from the registry token service are cached and reused for the following requests.
+func (c *Client) do(req *http.Request, ref *Reference) (*http.Response, error) {
+	scope := fmt.Sprintf("repository:%s:pull", ref.Repository)
+	key := fmt.Sprintf("%s|%s", ref.Registry, scope)
+
+	c.mu.Lock()
+	cached := c.tokens[key]
+	c.mu.Unlock()
+
+	switch {
+	case c.Token != "":
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Token))
+	case cached != "":
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cached))
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusUnauthorized || c.Token != "" {
+		return res, nil
+	}
+
+	challenge := res.Header.Get("WWW-Authenticate")
+	res.Body.Close()
+
+	retry := req.Clone(req.Context())
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if c.Username == "" {
+			return nil, fmt.Errorf("registry %s requires credentials", ref.Registry)
+		}
+		retry.SetBasicAuth(c.Username, c.Password)
+	case "bearer":
+		if params["scope"] == "" {
+			params["scope"] = scope
+		}
+
+		token, err := c.fetchToken(req.Context(), params)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		c.tokens[key] = token
+		c.mu.Unlock()
+
+		retry.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	default:
+		return nil, fmt.Errorf("registry %s requested an unsupported authentication scheme: %q", ref.Registry, challenge)
+	}
+
+	return c.client.Do(retry)
+}
+
+// fetchToken requests a bearer token to the token service described by a WWW-Authenticate challenge.
+func (c *Client) fetchToken(ctx context.Context, params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid token service realm %q", params["realm"])
+	}
+
+	q := realm.Query()
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			q.Set(k, params[k])
+		}
+	}
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get registry token: %s", res.Status)
+	}
+
+	t := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+		return "", fmt.Errorf("failed to decode registry token: %v", err)
+	}
+
+	if t.Token != "" {
+		return t.Token, nil
+	}
+
+	if t.AccessToken != "" {
+		return t.AccessToken, nil
+	}
+
+	return "", fmt.Errorf("registry token service returned no token")
+}
+
+// parseChallenge parses a WWW-Authenticate header value such as: Bearer realm="https://auth.example.com/token",service="registry"
+// The lower cased scheme and the challenge parameters are returned.
+func parseChallenge(header string) (string, map[string]string) {
+	params := map[string]string{}
+
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		key, value, found := strings.Cut(rest, "=")
+		if !found {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[key] = value[1:]
+				break
+			}
+			params[key] = value[1 : end+1]
+			rest = strings.TrimPrefix(strings.TrimSpace(value[end+2:]), ",")
+			continue
+		}
+
+		value, rest, _ = strings.Cut(value, ",")
+		params[key] = strings.TrimSpace(value)
+	}
+
+	return strings.ToLower(scheme), params
+}
+
+// isLocalhost reports whether a registry host points to the local machine.
+func isLocalhost(registry string) bool {
+	host := registry
+	if h, _, err := net.SplitHostPort(registry); err == nil {
+		host = h
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,193 @@
+package registry_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/registry"
+)
+
+const (
+	indexDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	amd64Digest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	arm64Digest = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+)
+
+// newTestRegistry starts a registry:2 style stand-in serving a multi-platform team/module:1.0 image. Manifests are
+// protected by a bearer token obtained from the /token endpoint with the user:secret credentials.
+func newTestRegistry(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query().Get("scope") != "repository:team/module:pull" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"token": "valid-token"})
+	})
+
+	mux.HandleFunc("/v2/team/module/manifests/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer valid-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:team/module:pull"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if !strings.HasSuffix(r.URL.Path, "/1.0") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", registry.MEDIA_TYPE_OCI_INDEX)
+		w.Header().Set("Docker-Content-Digest", indexDigest)
+		json.NewEncoder(w).Encode(registry.Manifest{
+			SchemaVersion: 2,
+			MediaType:     registry.MEDIA_TYPE_OCI_INDEX,
+			Manifests: []registry.Descriptor{
+				{MediaType: registry.MEDIA_TYPE_OCI_MANIFEST, Digest: amd64Digest, Platform: &registry.Platform{OS: "linux", Architecture: "amd64"}},
+				{MediaType: registry.MEDIA_TYPE_OCI_MANIFEST, Digest: arm64Digest, Platform: &registry.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+			},
+		})
+	})
+
+	// team/single:1.0 is a single platform image, its platform is declared in the image configuration
+	mux.HandleFunc("/v2/team/single/manifests/1.0", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", registry.MEDIA_TYPE_DOCKER_MANIFEST)
+		json.NewEncoder(w).Encode(registry.Manifest{
+			SchemaVersion: 2,
+			MediaType:     registry.MEDIA_TYPE_DOCKER_MANIFEST,
+			Config:        &registry.Descriptor{Digest: amd64Digest},
+		})
+	})
+
+	mux.HandleFunc("/v2/team/single/blobs/"+amd64Digest, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(registry.Platform{OS: "linux", Architecture: "amd64"})
+	})
+
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolve(t *testing.T) {
+	srv := newTestRegistry(t)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	c := registry.NewClient(nil).WithBasicAuth("user", "secret")
+
+	ref, err := registry.ParseReference(fmt.Sprintf("%s/team/module:1.0", host))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"":               indexDigest,
+		"linux/amd64":    amd64Digest,
+		"linux/arm64":    arm64Digest,
+		"linux/arm64/v8": arm64Digest,
+	}
+
+	for platform, expected := range tests {
+		digest, err := c.Resolve(context.Background(), ref, platform)
+		if err != nil {
+			t.Fatalf("unexpected error for platform '%s': %v", platform, err)
+		}
+
+		if digest != expected {
+			t.Errorf("expected '%s' got '%s' for platform '%s'", expected, digest, platform)
+		}
+	}
+
+	if ref.Pinned(arm64Digest) != fmt.Sprintf("%s/team/module@%s", host, arm64Digest) {
+		t.Errorf("unexpected pinned reference '%s'", ref.Pinned(arm64Digest))
+	}
+
+	var platformErr *registry.PlatformNotFoundError
+	if _, err := c.Resolve(context.Background(), ref, "linux/arm/v7"); !errors.As(err, &platformErr) {
+		t.Errorf("expected a platform not found error, got %v", err)
+	}
+
+	missing, _ := registry.ParseReference(fmt.Sprintf("%s/team/module:2.0", host))
+	var notFoundErr *registry.ManifestNotFoundError
+	if _, err := c.Resolve(context.Background(), missing, ""); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a manifest not found error, got %v", err)
+	}
+
+	if _, err := registry.NewClient(nil).WithBasicAuth("user", "wrong").Resolve(context.Background(), ref, ""); err == nil {
+		t.Error("expected an error with invalid credentials")
+	}
+}
+
+func TestPlatforms(t *testing.T) {
+	srv := newTestRegistry(t)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	c := registry.NewClient(nil).WithBasicAuth("user", "secret")
+
+	tests := map[string][]string{
+		"team/module:1.0": {"linux/amd64", "linux/arm64/v8"},
+		"team/single:1.0": {"linux/amd64"},
+	}
+
+	for image, expected := range tests {
+		ref, _ := registry.ParseReference(fmt.Sprintf("%s/%s", host, image))
+		platforms, err := c.Platforms(context.Background(), ref)
+		if err != nil {
+			t.Fatalf("unexpected error for '%s': %v", image, err)
+		}
+
+		got := []string{}
+		for _, p := range platforms {
+			got = append(got, p.String())
+		}
+
+		if strings.Join(got, ",") != strings.Join(expected, ",") {
+			t.Errorf("expected %v got %v for '%s'", expected, got, image)
+		}
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		image      string
+		registry   string
+		repository string
+		tag        string
+		digest     string
+	}{
+		{"nginx", "docker.io", "library/nginx", "latest", ""},
+		{"team/module:1.0", "docker.io", "team/module", "1.0", ""},
+		{"localhost:5000/module", "localhost:5000", "module", "latest", ""},
+		{"myacr.azurecr.io/team/module:1.0", "myacr.azurecr.io", "team/module", "1.0", ""},
+		{"myacr.azurecr.io/module@" + amd64Digest, "myacr.azurecr.io", "module", "", amd64Digest},
+		{"myacr.azurecr.io/module:1.0@" + amd64Digest, "myacr.azurecr.io", "module", "1.0", amd64Digest},
+	}
+
+	for _, tt := range tests {
+		ref, err := registry.ParseReference(tt.image)
+		if err != nil {
+			t.Fatalf("unexpected error for '%s': %v", tt.image, err)
+		}
+
+		if ref.Registry != tt.registry || ref.Repository != tt.repository || ref.Tag != tt.tag || ref.Digest != tt.digest {
+			t.Errorf("unexpected reference for '%s': %+v", tt.image, ref)
+		}
+	}
+
+	for _, image := range []string{"", "Module:1.0", "module:", "module@sha256:abc", "my_acr.azurecr.io:x/module"} {
+		if _, err := registry.ParseReference(image); err == nil {
+			t.Errorf("expected an error for '%s'", image)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package releaser
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+// LeaseHeldError is returned when a device is leased by another draft session.
+type LeaseHeldError struct {
+	DeviceId string
+	Lease    azure.Lease
+}
+
+// Implement the error interface
+func (e *LeaseHeldError) Error() string {
+	return fmt.Sprintf("device '%s' is locked by %s (session %s) until %s", e.DeviceId, e.Lease.Owner, e.Lease.Session, e.Lease.ExpiresAt.Local().Format(time.RFC3339))
+}
+
+// RolloutInProgressError is returned when a release is already being rolled out for the deployment.
+type RolloutInProgressError struct {
+	DeploymentId string
+	ReleaseId    string
+	Step         string
+}
+
+// Implement the error interface
+func (e *RolloutInProgressError) Error() string {
+	return fmt.Sprintf("release %s of '%s' is being rolled out (step %s)", e.ReleaseId, e.DeploymentId, e.Step)
+}
+
+// RolloutFailedError is returned when the devices of a rollout step are not healthy, the rollout being rolled back.
+type RolloutFailedError struct {
+	Step   string
+	Health RolloutHealth
+	Reason string
+}
+
+// Implement the error interface
+func (e *RolloutFailedError) Error() string {
+	return fmt.Sprintf("rollout step %s failed: %s (%s)", e.Step, e.Reason, e.Health)
+}
@@ -0,0 +1,113 @@
+package releaser
+
+import (
+	"sync"
+	"time"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+// The statuses of the release of a configuration to a hub of a fan-out.
+const (
+	HUB_RELEASED        = "released"
+	HUB_FAILED          = "failed"
+	HUB_SKIPPED         = "skipped"
+	HUB_ROLLED_BACK     = "rolled-back"
+	HUB_ROLLBACK_FAILED = "rollback-failed"
+)
+
+// HubReleaser is a hub a configuration is fanned out to.
+type HubReleaser struct {
+	// Hub is the name of the hub.
+	Hub string
+	// Releaser releases to the hub.
+	Releaser *AzureReleaser
+}
+
+// HubResult is the result of the release of a configuration to a hub.
+type HubResult struct {
+	Hub    string
+	Status string
+	// Error is the error of the release or of its rollback.
+	Error string
+	// Duration is the time the release took.
+	Duration time.Duration
+}
+
+// FanOut releases a configuration to several hubs concurrently, at most workers at a time, and returns the result of
+// every hub in the order of the hubs. With allOrNothing, the hubs not released yet are skipped as soon as a release
+// fails, and the hubs already released are rolled back to the configuration they had.
+func FanOut(hubs []HubReleaser, c *azure.Configuration, workers int, allOrNothing bool) []HubResult {
+	results := make([]HubResult, len(hubs))
+	previous := make([]*azure.Configuration, len(hubs))
+
+	var (
+		mu     sync.Mutex
+		failed bool
+		wg     sync.WaitGroup
+	)
+
+	jobs := make(chan int)
+	for w := 0; w < max(workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i].Hub = hubs[i].Hub
+
+				mu.Lock()
+				skip := failed && allOrNothing
+				mu.Unlock()
+
+				if skip {
+					results[i].Status = HUB_SKIPPED
+					continue
+				}
+
+				start := time.Now()
+				d := *c
+				prev, err := hubs[i].Releaser.ReplaceRelease(&d)
+				results[i].Duration = time.Since(start)
+
+				if err != nil {
+					results[i].Status = HUB_FAILED
+					results[i].Error = err.Error()
+
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+					continue
+				}
+
+				results[i].Status = HUB_RELEASED
+				previous[i] = prev
+			}
+		}()
+	}
+
+	for i := range hubs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if !failed || !allOrNothing {
+		return results
+	}
+
+	for i, r := range results {
+		if r.Status != HUB_RELEASED {
+			continue
+		}
+
+		if err := hubs[i].Releaser.RestoreRelease(c.Id, previous[i]); err != nil {
+			results[i].Status = HUB_ROLLBACK_FAILED
+			results[i].Error = err.Error()
+			continue
+		}
+
+		results[i].Status = HUB_ROLLED_BACK
+	}
+
+	return results
+}
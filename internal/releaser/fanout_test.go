@@ -0,0 +1,66 @@
+package releaser_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/releaser"
+)
+
+// fanOutHubs returns released fleets and a broken hub last, answering every request with an error.
+func fanOutHubs(t *testing.T, fleets ...*fakeFleet) []releaser.HubReleaser {
+	hubs := []releaser.HubReleaser{}
+	for i, f := range fleets {
+		r := newTestReleaser(t, f)
+		if err := r.ReleaseModule(release("app:1")); err != nil {
+			t.Fatal(err)
+		}
+
+		hubs = append(hubs, releaser.HubReleaser{Hub: string(rune('a' + i)), Releaser: r})
+	}
+
+	broken := newTestReleaser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	return append(hubs, releaser.HubReleaser{Hub: "broken", Releaser: broken})
+}
+
+func TestFanOut(t *testing.T) {
+	a, b := newFakeFleet(1), newFakeFleet(1)
+	results := releaser.FanOut(fanOutHubs(t, a, b), release("app:2"), 2, false)
+
+	expected := []string{releaser.HUB_RELEASED, releaser.HUB_RELEASED, releaser.HUB_FAILED}
+	for i, r := range results {
+		if r.Status != expected[i] {
+			t.Errorf("expected hub %s to be %s, got %s (%s)", r.Hub, expected[i], r.Status, r.Error)
+		}
+	}
+
+	if a.image("my-module") != "app:2" || b.image("my-module") != "app:2" {
+		t.Error("expected the hubs to be released")
+	}
+}
+
+func TestFanOutAllOrNothing(t *testing.T) {
+	a, b := newFakeFleet(1), newFakeFleet(1)
+	results := releaser.FanOut(fanOutHubs(t, a, b), release("app:2"), 3, true)
+
+	expected := []string{releaser.HUB_ROLLED_BACK, releaser.HUB_ROLLED_BACK, releaser.HUB_FAILED}
+	for i, r := range results {
+		if r.Status != expected[i] {
+			t.Errorf("expected hub %s to be %s, got %s (%s)", r.Hub, expected[i], r.Status, r.Error)
+		}
+	}
+
+	if a.image("my-module") != "app:1" || b.image("my-module") != "app:1" {
+		t.Error("expected the hubs to be rolled back to the previous release")
+	}
+
+	// with a single worker, the hubs after the failing one are skipped
+	hubs := fanOutHubs(t, newFakeFleet(1))
+	hubs = append(hubs[1:], hubs[0])
+	results = releaser.FanOut(hubs, release("app:2"), 1, true)
+	if results[0].Status != releaser.HUB_FAILED || results[1].Status != releaser.HUB_SKIPPED {
+		t.Errorf("expected the hub after the failing one to be skipped, got %v", results)
+	}
+}
@@ -0,0 +1,51 @@
+package releaser
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+// RunJob schedules a job in Azure IoT Hub and polls its status every interval until it is over. The progress function,
+// if any, is called with the status of the job after every poll. The final status of the job is returned, an error is
+// returned if the job failed or was cancelled.
+func (az *AzureReleaser) RunJob(j azure.Job, interval time.Duration, progress func(*azure.Job)) (*azure.Job, error) {
+	job, res, err := az.Client.Jobs.ScheduleJob(j)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = res.Expect(http.StatusOK); err != nil {
+		return nil, fmt.Errorf("failed to schedule job %s: %v", j.JobId, res.Response.Header["Iothub-Errorcode"])
+	}
+
+	for !job.Done() {
+		time.Sleep(interval)
+
+		job, res, err = az.Client.Jobs.GetJob(j.JobId)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = res.Expect(http.StatusOK); err != nil {
+			return nil, fmt.Errorf("failed to get job %s: %v", j.JobId, res.Response.Header["Iothub-Errorcode"])
+		}
+
+		if progress != nil {
+			progress(job)
+		}
+	}
+
+	if job.Status != azure.JOB_STATUS_COMPLETED {
+		reason := job.FailureReason
+		if reason == "" {
+			reason = job.StatusMessage
+		}
+
+		return job, fmt.Errorf("job %s %s: %s", job.JobId, job.Status, reason)
+	}
+
+	return job, nil
+}
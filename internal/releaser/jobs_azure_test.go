@@ -0,0 +1,85 @@
+package releaser_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+// fakeJobs is an IoT Hub stand-in running a single job, which takes a number of polls to complete.
+type fakeJobs struct {
+	mu    sync.Mutex
+	job   azure.Job
+	polls int
+	// fail makes the job fail once it is over
+	fail bool
+}
+
+func (f *fakeJobs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		json.NewDecoder(r.Body).Decode(&f.job)
+		f.job.Status = azure.JOB_STATUS_QUEUED
+		f.job.DeviceJobStatistics = &azure.JobDeviceStatistics{DeviceCount: f.polls}
+	case http.MethodGet:
+		stats := f.job.DeviceJobStatistics
+		f.job.Status = azure.JOB_STATUS_RUNNING
+		if stats.SucceededCount++; stats.SucceededCount == stats.DeviceCount {
+			f.job.Status = azure.JOB_STATUS_COMPLETED
+			if f.fail {
+				f.job.Status = azure.JOB_STATUS_FAILED
+				f.job.FailureReason = "throttled"
+			}
+		}
+	}
+
+	json.NewEncoder(w).Encode(f.job)
+}
+
+func TestRunJob(t *testing.T) {
+	f := &fakeJobs{polls: 3}
+	r := newTestReleaser(t, f)
+
+	statuses := []string{}
+	j := azure.NewTwinUpdateJob("tag", "tags.environment='dev'", map[string]interface{}{"ring": "canary"})
+	job, err := r.RunJob(j, time.Millisecond, func(job *azure.Job) {
+		statuses = append(statuses, job.Status)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != azure.JOB_STATUS_COMPLETED || job.DeviceJobStatistics.SucceededCount != 3 {
+		t.Errorf("expected the job to complete, got %+v", job)
+	}
+
+	if len(statuses) != 3 || statuses[0] != azure.JOB_STATUS_RUNNING {
+		t.Errorf("expected the progress of every poll, got %v", statuses)
+	}
+
+	if f.job.Type != azure.JOB_UPDATE_TWIN || f.job.QueryCondition != "tags.environment='dev'" || f.job.UpdateTwin.ETag != "*" {
+		t.Errorf("unexpected job %+v", f.job)
+	}
+}
+
+func TestRunJobFailed(t *testing.T) {
+	f := &fakeJobs{polls: 1, fail: true}
+	r := newTestReleaser(t, f)
+
+	j := azure.NewDeviceMethodJob("restart", "tags.ring='canary'", azure.NewMethodInvocation("reboot", nil, 0, time.Minute))
+	job, err := r.RunJob(j, time.Millisecond, nil)
+	if err == nil || job == nil || job.Status != azure.JOB_STATUS_FAILED {
+		t.Fatalf("expected the job to fail, got %v", err)
+	}
+
+	if f.job.CloudToDeviceMethod == nil || f.job.CloudToDeviceMethod.MethodName != "reboot" {
+		t.Errorf("unexpected job %+v", f.job)
+	}
+}
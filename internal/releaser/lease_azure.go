@@ -0,0 +1,74 @@
+package releaser
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+// leaseAttempts is the number of times a lease update is attempted when the twin changes concurrently.
+const leaseAttempts = 3
+
+// AcquireLease acquires the lease of a device for a draft session, or renews it if the session already holds it. The
+// twin is updated only if it did not change since it was read (ETag), so two clients cannot both acquire the lease.
+// LeaseHeldError is returned if another session holds an unexpired lease, unless force is set. The lease replaced by
+// force is returned, nil otherwise.
+func (az *AzureReleaser) AcquireLease(deviceId string, lease azure.Lease, force bool) (*azure.Lease, error) {
+	return az.updateLease(deviceId, lease.Session, &lease, force)
+}
+
+// ReleaseLease releases the lease of a device held by a draft session. Releasing a device that is not leased succeeds,
+// LeaseHeldError is returned if another session holds an unexpired lease, unless force is set.
+func (az *AzureReleaser) ReleaseLease(deviceId, session string, force bool) error {
+	_, err := az.updateLease(deviceId, session, nil, force)
+	return err
+}
+
+// updateLease sets the lease of a device on behalf of a session, a nil lease removing it. The update is retried when the
+// twin changed concurrently.
+func (az *AzureReleaser) updateLease(deviceId, session string, lease *azure.Lease, force bool) (*azure.Lease, error) {
+	for attempt := 1; ; attempt++ {
+		twin, res, err := az.Client.Devices.GetTwin(deviceId)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = res.Expect(http.StatusOK); err != nil {
+			return nil, fmt.Errorf("failed to get the device twin: %v", res.Response.Header["Iothub-Errorcode"])
+		}
+
+		current, err := twin.Lease()
+		if err != nil {
+			return nil, fmt.Errorf("invalid lease on device '%s': %v", deviceId, err)
+		}
+
+		if current == nil && lease == nil {
+			return nil, nil
+		}
+
+		var replaced *azure.Lease
+		if current != nil && current.Session != session && !current.Expired(time.Now()) {
+			if !force {
+				return nil, &LeaseHeldError{DeviceId: deviceId, Lease: *current}
+			}
+			replaced = current
+		}
+
+		_, res, err = az.Client.Devices.UpdateTwinTagsIfMatch(deviceId, azure.LeaseTags(lease), twin.ETag)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.Is(http.StatusPreconditionFailed) && attempt < leaseAttempts {
+			continue
+		}
+
+		if err = res.Expect(http.StatusOK); err != nil {
+			return nil, fmt.Errorf("failed to update the device lease: %v", res.Response.Header["Iothub-Errorcode"])
+		}
+
+		return replaced, nil
+	}
+}
@@ -0,0 +1,177 @@
+package releaser_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+	"github.com/unbrikd/edge-leap/internal/releaser"
+)
+
+// fakeHub is an IoT Hub stand-in holding the twin of a single device.
+type fakeHub struct {
+	mu      sync.Mutex
+	tags    map[string]interface{}
+	version int
+	// conflicts is the number of tags updates answered with 412, as if the twin changed concurrently
+	conflicts int
+}
+
+func (h *fakeHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !strings.HasPrefix(r.URL.Path, "/twins/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPatch {
+		if h.conflicts > 0 || r.Header.Get("If-Match") != fmt.Sprintf(`"%d"`, h.version) {
+			h.conflicts--
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		patch := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&patch)
+		merge(h.tags, patch["tags"].(map[string]interface{}))
+		h.version++
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"deviceId": "dev", "etag": fmt.Sprint(h.version), "tags": h.tags})
+}
+
+// merge merges a twin tags patch, nil values remove the tags.
+func merge(tags, patch map[string]interface{}) {
+	for k, v := range patch {
+		p, ok := v.(map[string]interface{})
+		if !ok {
+			if v == nil {
+				delete(tags, k)
+			} else {
+				tags[k] = v
+			}
+			continue
+		}
+
+		child, ok := tags[k].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			tags[k] = child
+		}
+		merge(child, p)
+	}
+}
+
+func lease(session string, expiresIn time.Duration) azure.Lease {
+	return azure.Lease{Owner: session + "@host", Session: session, ExpiresAt: time.Now().Add(expiresIn).UTC()}
+}
+
+func currentLease(t *testing.T, r *releaser.AzureReleaser) *azure.Lease {
+	twin, _, err := r.Client.Devices.GetTwin("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := twin.Lease()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+func TestAcquireLease(t *testing.T) {
+	h := &fakeHub{tags: map[string]interface{}{}}
+	r := newTestReleaser(t, h)
+
+	if _, err := r.AcquireLease("dev", lease("alice", time.Hour), false); err != nil {
+		t.Fatal(err)
+	}
+
+	// renewing a lease held by the same session succeeds
+	if _, err := r.AcquireLease("dev", lease("alice", 2*time.Hour), false); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := r.AcquireLease("dev", lease("bob", time.Hour), false)
+	if held, ok := err.(*releaser.LeaseHeldError); !ok || held.Lease.Session != "alice" {
+		t.Fatalf("expected the lease to be held by alice, got %v", err)
+	}
+
+	replaced, err := r.AcquireLease("dev", lease("bob", time.Hour), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replaced == nil || replaced.Session != "alice" {
+		t.Errorf("expected the lease of alice to be replaced, got %v", replaced)
+	}
+
+	if l := currentLease(t, r); l == nil || l.Session != "bob" {
+		t.Errorf("expected the lease to be held by bob, got %v", l)
+	}
+}
+
+func TestAcquireExpiredLease(t *testing.T) {
+	h := &fakeHub{tags: map[string]interface{}{}}
+	r := newTestReleaser(t, h)
+
+	if _, err := r.AcquireLease("dev", lease("alice", -time.Minute), false); err != nil {
+		t.Fatal(err)
+	}
+
+	replaced, err := r.AcquireLease("dev", lease("bob", time.Hour), false)
+	if err != nil || replaced != nil {
+		t.Fatalf("expected an expired lease to be acquired silently, got %v (%v)", replaced, err)
+	}
+}
+
+func TestAcquireLeaseConcurrentUpdate(t *testing.T) {
+	h := &fakeHub{tags: map[string]interface{}{}, conflicts: 2}
+	r := newTestReleaser(t, h)
+
+	if _, err := r.AcquireLease("dev", lease("alice", time.Hour), false); err != nil {
+		t.Fatal(err)
+	}
+
+	h.conflicts = 3
+	if _, err := r.AcquireLease("dev", lease("alice", time.Hour), false); err == nil {
+		t.Fatal("expected an error when the twin keeps changing")
+	}
+}
+
+func TestReleaseLease(t *testing.T) {
+	h := &fakeHub{tags: map[string]interface{}{"application": map[string]interface{}{"myModule": "alice"}}}
+	r := newTestReleaser(t, h)
+
+	if err := r.ReleaseLease("dev", "alice", false); err != nil {
+		t.Fatalf("expected releasing a free device to succeed, got %v", err)
+	}
+
+	if _, err := r.AcquireLease("dev", lease("alice", time.Hour), false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.ReleaseLease("dev", "bob", false); err == nil {
+		t.Fatal("expected an error when releasing the lease of another session")
+	}
+
+	if err := r.ReleaseLease("dev", "alice", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if l := currentLease(t, r); l != nil {
+		t.Errorf("expected the lease to be released, got %v", l)
+	}
+
+	if h.tags["application"].(map[string]interface{})["myModule"] != "alice" {
+		t.Error("expected the other tags to be left untouched")
+	}
+}
@@ -0,0 +1,159 @@
+package releaser
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+// ApplyToDevice merges the modules and the routes of a configuration into the deployment manifest of a device and
+// applies the manifest to the device, so the modules are set immediately on exactly one device and its other modules
+// keep running. The device must already have a deployment manifest.
+func (az *AzureReleaser) ApplyToDevice(deviceId string, c *azure.Configuration) error {
+	manifest, err := az.deviceManifest(deviceId)
+	if err != nil {
+		return err
+	}
+
+	modulesContent, _ := c.Content["modulesContent"].(map[string]interface{})
+	for mod, content := range modulesContent {
+		props, ok := content.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		desired, ok := manifest[mod]
+		if !ok {
+			desired = map[string]interface{}{}
+			manifest[mod] = desired
+		}
+
+		// configurations set the desired properties by path, e.g. properties.desired.modules.myModule
+		for path, v := range props {
+			if path == "properties.desired" {
+				if m, ok := v.(map[string]interface{}); ok {
+					for k, v := range m {
+						desired[k] = v
+					}
+				}
+				continue
+			}
+
+			if k, found := strings.CutPrefix(path, "properties.desired."); found {
+				setPath(desired, strings.Split(k, "."), v)
+			}
+		}
+	}
+
+	return az.applyManifest(deviceId, manifest)
+}
+
+// RemoveModuleFromManifest removes a module from the deployment manifest of a device, along with the $edgeHub routes
+// reading from or writing to the module, the other modules keep running. Removing a module the manifest does not hold
+// succeeds.
+func (az *AzureReleaser) RemoveModuleFromManifest(deviceId, module string) error {
+	manifest, err := az.deviceManifest(deviceId)
+	if err != nil {
+		return err
+	}
+
+	removed := false
+	modules, _ := manifest[azure.EDGE_AGENT]["modules"].(map[string]interface{})
+	if _, ok := modules[module]; ok {
+		delete(modules, module)
+		removed = true
+	}
+
+	routes, _ := manifest[azure.EDGE_HUB]["routes"].(map[string]interface{})
+	for name, route := range routes {
+		if routesModule(route, module) {
+			delete(routes, name)
+			removed = true
+		}
+	}
+
+	if !removed {
+		return nil
+	}
+
+	return az.applyManifest(deviceId, manifest)
+}
+
+// routesModule reports whether a route of the $edgeHub reads from or writes to a module. The route is either the route
+// string or an object holding it along with its priority and time to live.
+func routesModule(route interface{}, module string) bool {
+	if r, ok := route.(map[string]interface{}); ok {
+		route = r["route"]
+	}
+
+	s, _ := route.(string)
+	return regexp.MustCompile(`/modules/` + regexp.QuoteMeta(module) + `\b`).MatchString(s)
+}
+
+// deviceManifest returns the deployment manifest of a device, the desired properties of the $edgeAgent and $edgeHub
+// modules read from their twins, by module id. The properties set by the hub ($metadata, $version) are removed.
+func (az *AzureReleaser) deviceManifest(deviceId string) (map[string]map[string]interface{}, error) {
+	manifest := map[string]map[string]interface{}{}
+	for _, mod := range []string{azure.EDGE_AGENT, azure.EDGE_HUB} {
+		twin, res, err := az.Client.Devices.GetModuleTwin(deviceId, mod)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = res.Expect(http.StatusOK); err != nil {
+			return nil, fmt.Errorf("failed to get the twin of %s: %v", mod, res.Response.Header["Iothub-Errorcode"])
+		}
+
+		desired := map[string]interface{}{}
+		if twin.Properties != nil {
+			for k, v := range twin.Properties.Desired {
+				if !strings.HasPrefix(k, "$") {
+					desired[k] = v
+				}
+			}
+		}
+		manifest[mod] = desired
+	}
+
+	if _, ok := manifest[azure.EDGE_AGENT]["systemModules"]; !ok {
+		return nil, fmt.Errorf("device '%s' has no deployment manifest to apply the modules to", deviceId)
+	}
+
+	return manifest, nil
+}
+
+// applyManifest applies a deployment manifest, the desired properties by module id, to a device.
+func (az *AzureReleaser) applyManifest(deviceId string, manifest map[string]map[string]interface{}) error {
+	modulesContent := map[string]interface{}{}
+	for mod, desired := range manifest {
+		modulesContent[mod] = map[string]interface{}{"properties.desired": desired}
+	}
+
+	res, err := az.Client.Configurations.ApplyConfigurationContent(deviceId, map[string]interface{}{"modulesContent": modulesContent})
+	if err != nil {
+		return err
+	}
+
+	if err = res.Expect(http.StatusOK, http.StatusNoContent); err != nil {
+		return fmt.Errorf("failed to apply the configuration content: %v", res.Response.Header["Iothub-Errorcode"])
+	}
+
+	return nil
+}
+
+// setPath sets a value in nested properties given its path, creating the missing properties.
+func setPath(props map[string]interface{}, path []string, v interface{}) {
+	for _, k := range path[:len(path)-1] {
+		child, ok := props[k].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			props[k] = child
+		}
+		props = child
+	}
+
+	props[path[len(path)-1]] = v
+}
@@ -0,0 +1,131 @@
+package releaser_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+// fakeDevice is an IoT Hub stand-in holding the deployment manifest of a single device, the desired properties of the
+// $edgeAgent and $edgeHub modules.
+type fakeDevice struct {
+	mu       sync.Mutex
+	manifest map[string]map[string]interface{}
+	applied  int
+}
+
+func (d *fakeDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/devices/dev/applyConfigurationContent":
+		content := struct {
+			ModulesContent map[string]map[string]map[string]interface{} `json:"modulesContent"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&content)
+
+		for mod, props := range content.ModulesContent {
+			d.manifest[mod] = props["properties.desired"]
+		}
+		d.applied++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/twins/dev/modules/"):
+		mod := strings.TrimPrefix(r.URL.Path, "/twins/dev/modules/")
+		desired := map[string]interface{}{"$version": 3, "$metadata": map[string]interface{}{}}
+		for k, v := range d.manifest[mod] {
+			desired[k] = v
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"deviceId": "dev", "moduleId": mod, "properties": map[string]interface{}{"desired": desired}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (d *fakeDevice) modules() map[string]interface{} {
+	modules, _ := d.manifest[azure.EDGE_AGENT]["modules"].(map[string]interface{})
+	return modules
+}
+
+func deviceWithManifest() *fakeDevice {
+	return &fakeDevice{manifest: map[string]map[string]interface{}{
+		azure.EDGE_AGENT: {
+			"schemaVersion": "1.1",
+			"systemModules": map[string]interface{}{"edgeAgent": map[string]interface{}{}, "edgeHub": map[string]interface{}{}},
+			"modules":       map[string]interface{}{"sensor": map[string]interface{}{"settings": map[string]interface{}{"image": "sensor:1.0"}}},
+		},
+		azure.EDGE_HUB: {
+			"schemaVersion": "1.1",
+			"routes":        map[string]interface{}{"sensorToUpstream": "FROM /messages/modules/sensor/* INTO $upstream"},
+		},
+	}}
+}
+
+func TestApplyToDevice(t *testing.T) {
+	d := deviceWithManifest()
+	r := newTestReleaser(t, d)
+
+	c := azure.Configuration{Id: "draft"}
+	c.SetContent("myModule", "my-module:1.0", "{}", 1, nil)
+	c.SetRoutes(map[string]string{
+		"myModuleToUpstream": "FROM /messages/modules/myModule/* INTO $upstream",
+		"sensorToMyModule":   `FROM /messages/modules/sensor/* INTO BrokeredEndpoint("/modules/myModule/inputs/input1")`,
+	})
+
+	if err := r.ApplyToDevice("dev", &c); err != nil {
+		t.Fatal(err)
+	}
+
+	modules := d.modules()
+	if _, ok := modules["sensor"]; !ok {
+		t.Error("expected the other modules of the device to be kept")
+	}
+
+	if m, ok := modules["myModule"].(map[string]interface{}); !ok || m["settings"].(map[string]interface{})["image"] != "my-module:1.0" {
+		t.Errorf("expected the module to be applied, got %v", modules)
+	}
+
+	routes := d.manifest[azure.EDGE_HUB]["routes"].(map[string]interface{})
+	if len(routes) != 3 {
+		t.Errorf("expected the routes to be merged, got %v", routes)
+	}
+
+	if _, ok := d.manifest[azure.EDGE_AGENT]["$version"]; ok {
+		t.Error("expected the properties set by the hub to be removed")
+	}
+
+	if err := r.RemoveModuleFromManifest("dev", "myModule"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := d.modules()["myModule"]; ok || len(d.modules()) != 1 {
+		t.Errorf("expected only the module to be removed, got %v", d.modules())
+	}
+
+	if routes := d.manifest[azure.EDGE_HUB]["routes"].(map[string]interface{}); len(routes) != 1 || routes["sensorToUpstream"] == nil {
+		t.Errorf("expected only the routes of the module to be removed, got %v", routes)
+	}
+
+	// removing a module which is not deployed does not apply the manifest again
+	applied := d.applied
+	if err := r.RemoveModuleFromManifest("dev", "myModule"); err != nil || d.applied != applied {
+		t.Errorf("expected nothing to be applied, got %v", err)
+	}
+}
+
+func TestApplyToDeviceWithoutManifest(t *testing.T) {
+	d := &fakeDevice{manifest: map[string]map[string]interface{}{}}
+	r := newTestReleaser(t, d)
+
+	c := azure.Configuration{Id: "draft"}
+	c.SetContent("myModule", "my-module:1.0", "{}", 1, nil)
+
+	if err := r.ApplyToDevice("dev", &c); err == nil || d.applied != 0 {
+		t.Fatal("expected an error when the device has no deployment manifest")
+	}
+}
@@ -24,15 +24,22 @@ func Azure(c *azure.Client) *AzureReleaser {
 // If a configuration with the same id already exists, it will be deleted and replaced.
 // If the configuration fails to be created, the previous configuration will be restored.
 func (az *AzureReleaser) ReleaseModule(c *azure.Configuration) error {
+	_, err := az.ReplaceRelease(c)
+	return err
+}
+
+// ReplaceRelease releases a configuration like ReleaseModule and returns the configuration it replaced, nil if there
+// was none, so the release can be reverted with RestoreRelease.
+func (az *AzureReleaser) ReplaceRelease(c *azure.Configuration) (*azure.Configuration, error) {
 	currentConfig, err := az.configurationExists(c.Id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if currentConfig != nil {
 		err = az.configurationAttemptDelete(c.Id)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -42,10 +49,21 @@ func (az *AzureReleaser) ReleaseModule(c *azure.Configuration) error {
 			az.configurationAttemptCreate(currentConfig)
 		}
 
-		return err
+		return nil, err
 	}
 
-	return nil
+	return currentConfig, nil
+}
+
+// RestoreRelease reverts a release made with ReplaceRelease: the configuration it replaced is released again, or the
+// configuration is deleted if it replaced none.
+func (az *AzureReleaser) RestoreRelease(id string, previous *azure.Configuration) error {
+	if previous == nil {
+		return az.DeleteRelease(id)
+	}
+
+	r := releaseOf(previous, id)
+	return az.ReleaseModule(&r)
 }
 
 // SetModuleOnDevice sets the module name and version on the device twin tags in order to allow drafts to be deployed without manual intervention.
@@ -72,6 +90,87 @@ func (az *AzureReleaser) SetModuleOnDevice(deviceId, moduleName, moduleVersion s
 	return nil
 }
 
+// RemoveModuleFromDevice removes the module tag set by SetModuleOnDevice from the device twin, so the draft deployments of
+// the module no longer target the device.
+func (az *AzureReleaser) RemoveModuleFromDevice(deviceId, moduleName string) error {
+	twinTags := map[string]interface{}{
+		"tags": map[string]interface{}{
+			"application": map[string]interface{}{
+				moduleName: nil,
+			},
+		},
+	}
+
+	_, res, err := az.Client.Devices.UpdateTwinTags(deviceId, twinTags)
+	if err != nil {
+		return err
+	}
+
+	if err = res.Expect(http.StatusOK); err != nil {
+		return fmt.Errorf("failed to update the device twin: %v", res.Response.Header["Iothub-Errorcode"])
+	}
+
+	return nil
+}
+
+// DeleteRelease deletes a configuration from Azure IoT Hub. Deleting a configuration that does not exist succeeds.
+func (az *AzureReleaser) DeleteRelease(id string) error {
+	res, err := az.Client.Configurations.DeleteConfiguration(id)
+	if err != nil {
+		return err
+	}
+
+	if err = res.Expect(http.StatusNoContent, http.StatusNotFound); err != nil {
+		return fmt.Errorf("failed to delete configuration: %v", res.Response.Header["Iothub-Errorcode"])
+	}
+
+	return nil
+}
+
+// FindRelease returns the configuration of a release of a deployment, found by its releaseId label on the deployment or
+// on the rollout of the deployment. The configuration is returned ready to be released again under the deployment id:
+// the values set by the hub and the rollout labels are removed.
+func (az *AzureReleaser) FindRelease(deploymentId, releaseId string) (*azure.Configuration, error) {
+	for _, id := range []string{deploymentId, RolloutId(deploymentId)} {
+		c, err := az.configurationExists(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if c != nil && c.Labels["releaseId"] == releaseId {
+			r := releaseOf(c, deploymentId)
+			return &r, nil
+		}
+	}
+
+	return nil, fmt.Errorf("release %s of '%s' not found", releaseId, deploymentId)
+}
+
+// releaseOf returns a copy of a configuration read from the hub to be released under the deployment id, without the
+// values set by the hub and the rollout labels. The priority and the target condition of a rollout are brought back to
+// the ones of its deployment.
+func releaseOf(c *azure.Configuration, deploymentId string) azure.Configuration {
+	r := *c
+	r.Id = deploymentId
+	r.ETag = ""
+	r.CreatedTimeUtc = ""
+	r.LastUpdatedTimeUtc = ""
+	r.SystemMetrics = nil
+	r.Labels = map[string]string{}
+	for k, v := range c.Labels {
+		if k != LABEL_ROLLOUT_OF && k != LABEL_ROLLOUT_STEP {
+			r.Labels[k] = v
+		}
+	}
+
+	if c.Labels[LABEL_ROLLOUT_OF] != "" {
+		r.Priority--
+		r.TargetCondition = rolloutTarget(c.TargetCondition)
+	}
+
+	return r
+}
+
 // configurationExists checks if a configuration with the given id exists and returns it as a Configuration object.
 // If the configuration does not exist, nil is returned.
 func (az *AzureReleaser) configurationExists(id string) (*azure.Configuration, error) {
@@ -0,0 +1,77 @@
+package releaser_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+	"github.com/unbrikd/edge-leap/internal/releaser"
+)
+
+// newTestReleaser returns a releaser of an IoT Hub stand-in served by the handler for the duration of the test.
+func newTestReleaser(t *testing.T, h http.Handler) *releaser.AzureReleaser {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c := azure.NewClient(nil)
+	c.BaseURL, _ = url.Parse(srv.URL + "/")
+	return releaser.Azure(c)
+}
+
+func TestFindRelease(t *testing.T) {
+	f := newFakeFleet(3)
+	r := newTestReleaser(t, f)
+	if err := r.ReleaseModule(release("app:1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.StartRollout(release("app:2"), plan(releaser.RolloutStep{Ring: "canary"}, releaser.RolloutStep{})); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"app:1", "app:2"} {
+		c, err := r.FindRelease("my-module", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Id != "my-module" || c.Priority != 10 || c.ETag != "" || c.Labels["releaseId"] != id {
+			t.Errorf("expected release %s of my-module, got %s priority %d etag %s labels %v", id, c.Id, c.Priority, c.ETag, c.Labels)
+		}
+
+		// the condition of the current step of the rollout is specific to the hub
+		if c.TargetCondition != "tags.environment='prod'" {
+			t.Errorf("expected the target condition of release %s to be the one of the deployment, got %s", id, c.TargetCondition)
+		}
+
+		if _, ok := c.Labels[releaser.LABEL_ROLLOUT_STEP]; ok {
+			t.Errorf("expected the rollout labels to be removed, got %v", c.Labels)
+		}
+	}
+
+	if _, err := r.FindRelease("my-module", "app:0"); err == nil {
+		t.Error("expected an error for a release which is not deployed")
+	}
+
+	// the target condition of the deployment is found whatever the parentheses of its literals
+	target := "(tags.environment='prod' OR tags.site='(lab)') AND NOT (tags.site = 'x) AND y')"
+	p := plan(releaser.RolloutStep{Percent: 50}, releaser.RolloutStep{})
+	p.TargetCondition = target
+	d := release("app:3")
+	d.Id = "other-module"
+	d.TargetCondition = target
+	if _, err := r.StartRollout(d, p); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := r.FindRelease("other-module", "app:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.TargetCondition != target {
+		t.Errorf("expected the target condition %s, got %s", target, c.TargetCondition)
+	}
+}
@@ -0,0 +1,592 @@
+package releaser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+)
+
+// ROLLOUT_SUFFIX is appended to the deployment id to name the configuration of the release being rolled out. It is
+// deployed with a priority above the one of the deployment, which keeps serving the devices out of the rollout.
+const ROLLOUT_SUFFIX = "rollout"
+
+// The labels of the rollout configuration recording the state of the rollout, so it can be resumed.
+const (
+	// LABEL_ROLLOUT_OF is the id of the deployment the release is rolled out for.
+	LABEL_ROLLOUT_OF = "rolloutOf"
+	// LABEL_ROLLOUT_STEP is the index of the current step of the rollout.
+	LABEL_ROLLOUT_STEP = "rolloutStep"
+)
+
+// agentsBatchSize is the number of devices whose edge agent twins are queried at once.
+const agentsBatchSize = 50
+
+// tagsBatchSize is the number of devices tagged by a single job, the devices being listed in the query condition.
+const tagsBatchSize = 100
+
+// failedStatuses holds the runtime statuses of the modules reported as failed by the edge agent.
+var failedStatuses = map[string]bool{
+	"failed":    true,
+	"backoff":   true,
+	"unhealthy": true,
+}
+
+// RolloutPlan is the plan of a staged rollout: the release is deployed to a growing part of the target devices, step by
+// step, as long as the devices are healthy.
+type RolloutPlan struct {
+	// TargetCondition is the target condition of the deployment, the whole target of the rollout.
+	TargetCondition string
+	// RingTag is the twin tag naming the ring of the devices, for the steps targeting rings.
+	RingTag string
+	// Steps holds the steps of the rollout.
+	Steps []RolloutStep
+	// MinHealthy is the percentage of the devices of a step which must run the release.
+	MinHealthy int
+	// MaxFailed is the number of devices of a step which can fail before the rollout is rolled back.
+	MaxFailed int
+	// Timeout is the duration after which a step which is not healthy is rolled back.
+	Timeout time.Duration
+	// Interval is the duration between two health checks.
+	Interval time.Duration
+}
+
+// RolloutStep is a step of a rollout, targeting a percentage of the target devices, the devices of the rings of the
+// step and of the previous steps, or the whole target when it has neither.
+type RolloutStep struct {
+	Name    string
+	Percent int
+	Ring    string
+	// Wait is the minimum duration the devices of the step must run the release before the next step.
+	Wait time.Duration
+}
+
+// RolloutHealth is the health of the devices targeted by a rollout step.
+type RolloutHealth struct {
+	// Targeted is the number of devices targeted by the step.
+	Targeted int
+	// Healthy is the number of devices running every module of the release.
+	Healthy int
+	// Failed is the number of devices failing to apply the release or to run its modules.
+	Failed int
+	// Pending is the number of devices which have not reported running the release yet.
+	Pending int
+}
+
+// Implement the Stringer interface
+func (h RolloutHealth) String() string {
+	return fmt.Sprintf("%d devices targeted, %d healthy, %d failed, %d pending", h.Targeted, h.Healthy, h.Failed, h.Pending)
+}
+
+// Rollout is a release being rolled out.
+type Rollout struct {
+	az   *AzureReleaser
+	plan RolloutPlan
+	// Config is the configuration of the release being rolled out.
+	Config *azure.Configuration
+	// Step is the index of the current step.
+	Step int
+	// Progress is called with the health of the devices after every health check.
+	Progress func(step int, h RolloutHealth)
+}
+
+// StartRollout starts rolling out a release: its configuration is created for the devices of the first step of the
+// plan, under the id of the deployment suffixed with ROLLOUT_SUFFIX. The rollout goes on with Run.
+// RolloutInProgressError is returned if a release is already being rolled out for the deployment.
+func (az *AzureReleaser) StartRollout(c *azure.Configuration, plan RolloutPlan) (*Rollout, error) {
+	id := RolloutId(c.Id)
+	current, err := az.configurationExists(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if current != nil {
+		r := &Rollout{az: az, plan: plan, Config: current}
+		step, _ := strconv.Atoi(current.Labels[LABEL_ROLLOUT_STEP])
+		return nil, &RolloutInProgressError{DeploymentId: c.Id, ReleaseId: current.Labels["releaseId"], Step: r.StepName(step)}
+	}
+
+	rc := *c
+	rc.Id = id
+	rc.Priority = c.Priority + 1
+	rc.Labels = map[string]string{LABEL_ROLLOUT_OF: c.Id, LABEL_ROLLOUT_STEP: "0"}
+	for k, v := range c.Labels {
+		rc.Labels[k] = v
+	}
+
+	r := &Rollout{az: az, plan: plan, Config: &rc}
+	if rc.TargetCondition, err = r.condition(0); err != nil {
+		return nil, err
+	}
+
+	created, res, err := az.Client.Configurations.CreateConfiguration(context.Background(), rc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = res.Expect(http.StatusOK); err != nil {
+		r.clearTags()
+		return nil, fmt.Errorf("failed to create configuration: %v", res.Response.Header["Iothub-Errorcode"])
+	}
+
+	r.Config = created
+	return r, nil
+}
+
+// ResumeRollout resumes the rollout of the release of a deployment from the step it was left at, following the plan.
+func (az *AzureReleaser) ResumeRollout(deploymentId string, plan RolloutPlan) (*Rollout, error) {
+	c, err := az.configurationExists(RolloutId(deploymentId))
+	if err != nil {
+		return nil, err
+	}
+
+	if c == nil {
+		return nil, fmt.Errorf("no release of '%s' is being rolled out", deploymentId)
+	}
+
+	step, err := strconv.Atoi(c.Labels[LABEL_ROLLOUT_STEP])
+	if err != nil || step < 0 || step >= len(plan.Steps) {
+		return nil, fmt.Errorf("rollout step '%s' does not match the %d steps of the plan", c.Labels[LABEL_ROLLOUT_STEP], len(plan.Steps))
+	}
+
+	return &Rollout{az: az, plan: plan, Config: c, Step: step}, nil
+}
+
+// RolloutId returns the id of the configuration of the release being rolled out for a deployment.
+func RolloutId(deploymentId string) string {
+	return fmt.Sprintf("%s-%s", deploymentId, ROLLOUT_SUFFIX)
+}
+
+// StepName returns the name of a step of the rollout, defaulting to its ring or its percentage.
+func (r *Rollout) StepName(step int) string {
+	if step < 0 || step >= len(r.plan.Steps) {
+		return strconv.Itoa(step)
+	}
+
+	s := r.plan.Steps[step]
+	switch {
+	case s.Name != "":
+		return s.Name
+	case s.Ring != "":
+		return s.Ring
+	case s.Percent > 0:
+		return fmt.Sprintf("%d%%", s.Percent)
+	}
+
+	return "all"
+}
+
+// Run widens the rollout step by step, waiting for the devices of every step to be healthy, and releases the
+// configuration to the whole target once the last step is healthy. When the devices of a step are not healthy, the
+// rollout is rolled back and RolloutFailedError is returned. Other errors leave the rollout where it is, so it can be
+// resumed.
+func (r *Rollout) Run() error {
+	for ; r.Step < len(r.plan.Steps); r.Step++ {
+		if err := r.apply(); err != nil {
+			return err
+		}
+
+		if err := r.waitHealthy(); err != nil {
+			var failed *RolloutFailedError
+			if errors.As(err, &failed) {
+				if rbErr := r.Abort(); rbErr != nil {
+					return fmt.Errorf("%v, rollback failed: %v", err, rbErr)
+				}
+			}
+
+			return err
+		}
+	}
+
+	return r.promote()
+}
+
+// Abort rolls the rollout back: the configuration of the release is deleted and the devices are untagged, the devices
+// it targeted going back to the deployment.
+func (r *Rollout) Abort() error {
+	if err := r.az.DeleteRelease(r.Config.Id); err != nil {
+		return err
+	}
+
+	return r.clearTags()
+}
+
+// apply targets the devices of the current step.
+func (r *Rollout) apply() error {
+	cond, err := r.condition(r.Step)
+	if err != nil {
+		return err
+	}
+
+	step := strconv.Itoa(r.Step)
+	if cond == r.Config.TargetCondition && r.Config.Labels[LABEL_ROLLOUT_STEP] == step {
+		return nil
+	}
+
+	c := *r.Config
+	c.TargetCondition = cond
+	c.Labels = map[string]string{}
+	for k, v := range r.Config.Labels {
+		c.Labels[k] = v
+	}
+	c.Labels[LABEL_ROLLOUT_STEP] = step
+
+	updated, res, err := r.az.Client.Configurations.UpdateConfiguration(context.Background(), c)
+	if err != nil {
+		return err
+	}
+
+	if err = res.Expect(http.StatusOK); err != nil {
+		return fmt.Errorf("failed to update configuration: %v", res.Response.Header["Iothub-Errorcode"])
+	}
+
+	r.Config = updated
+	return nil
+}
+
+// waitHealthy waits for the devices of the current step to be healthy for the wait duration of the step. The step fails
+// when it stays unhealthy for the timeout of the plan, however long its wait duration.
+func (r *Rollout) waitHealthy() error {
+	s := r.plan.Steps[r.Step]
+	start := time.Now()
+	unhealthySince := start
+	for {
+		h, err := r.health()
+		if err != nil {
+			return err
+		}
+
+		if r.Progress != nil {
+			r.Progress(r.Step, h)
+		}
+
+		if h.Failed > r.plan.MaxFailed {
+			return &RolloutFailedError{Step: r.StepName(r.Step), Health: h, Reason: fmt.Sprintf("%d devices failed, %d allowed", h.Failed, r.plan.MaxFailed)}
+		}
+
+		// a step targeting no device is not healthy, its target condition or its ring may be wrong
+		if h.Targeted > 0 && h.Healthy*100 >= r.plan.MinHealthy*h.Targeted {
+			if time.Since(start) >= s.Wait {
+				return nil
+			}
+			unhealthySince = time.Now()
+		} else if time.Since(unhealthySince) >= r.plan.Timeout {
+			if h.Targeted == 0 {
+				return &RolloutFailedError{Step: r.StepName(r.Step), Health: h, Reason: fmt.Sprintf("no device targeted after %s", r.plan.Timeout)}
+			}
+			return &RolloutFailedError{Step: r.StepName(r.Step), Health: h, Reason: fmt.Sprintf("less than %d%% of the devices healthy after %s", r.plan.MinHealthy, r.plan.Timeout)}
+		}
+
+		time.Sleep(r.plan.Interval)
+	}
+}
+
+// promote releases the configuration to the whole target under the id of the deployment, and removes the rollout.
+func (r *Rollout) promote() error {
+	c := releaseOf(r.Config, r.deploymentId())
+	c.TargetCondition = r.plan.TargetCondition
+
+	if err := r.az.ReleaseModule(&c); err != nil {
+		return err
+	}
+
+	return r.Abort()
+}
+
+// condition returns the target condition of a step, tagging the devices it selects when it targets a percentage of
+// the devices.
+func (r *Rollout) condition(step int) (string, error) {
+	s := r.plan.Steps[step]
+	switch {
+	case s.Ring != "":
+		rings := []string{}
+		for _, p := range r.plan.Steps[:step+1] {
+			if p.Ring != "" {
+				rings = append(rings, quote(p.Ring))
+			}
+		}
+
+		return and(r.plan.TargetCondition, fmt.Sprintf("tags.%s IN [%s]", r.plan.RingTag, strings.Join(rings, ", "))), nil
+	case s.Percent > 0 && s.Percent < 100:
+		if err := r.tagDevices(s.Percent); err != nil {
+			return "", err
+		}
+
+		return and(r.plan.TargetCondition, fmt.Sprintf("tags.%s.%s = %s", azure.ROLLOUT_TAG, azure.RolloutKey(r.deploymentId()), quote(r.releaseId()))), nil
+	}
+
+	return r.plan.TargetCondition, nil
+}
+
+// tagDevices tags a percentage of the target devices with the release, with twin update jobs. The devices are ordered
+// by a hash of their id and of the deployment id, so every step selects the devices of the previous steps and the
+// devices selected do not depend on the order they were registered in.
+func (r *Rollout) tagDevices(percent int) error {
+	twins, err := r.queryTwins(fmt.Sprintf("SELECT * FROM devices%s", where(r.plan.TargetCondition)))
+	if err != nil {
+		return err
+	}
+
+	rank := func(deviceId string) uint64 {
+		h := fnv.New64a()
+		h.Write([]byte(r.deploymentId() + "/" + deviceId))
+		return h.Sum64()
+	}
+
+	sort.Slice(twins, func(i, j int) bool {
+		return rank(twins[i].DeviceId) < rank(twins[j].DeviceId)
+	})
+
+	path := fmt.Sprintf("%s.%s", azure.ROLLOUT_TAG, azure.RolloutKey(r.deploymentId()))
+	ids := []string{}
+	for _, t := range twins[:(len(twins)*percent+99)/100] {
+		if t.Tag(path) != r.releaseId() {
+			ids = append(ids, quote(t.DeviceId))
+		}
+	}
+
+	for i := 0; i < len(ids); i += tagsBatchSize {
+		cond := fmt.Sprintf("deviceId IN [%s]", strings.Join(ids[i:min(i+tagsBatchSize, len(ids))], ", "))
+		if err := r.setTags(cond, r.releaseId()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clearTags removes the rollout tag of the deployment from the devices, with a twin update job.
+func (r *Rollout) clearTags() error {
+	return r.setTags(fmt.Sprintf("is_defined(tags.%s.%s)", azure.ROLLOUT_TAG, azure.RolloutKey(r.deploymentId())), "")
+}
+
+// setTags sets the release rolled out to the devices matching a condition, an empty release removing it. The tags are
+// set by a twin update job, which the rollout waits for.
+func (r *Rollout) setTags(cond, releaseId string) error {
+	tags := azure.RolloutTags(r.deploymentId(), releaseId)["tags"].(map[string]interface{})
+	j := azure.NewTwinUpdateJob(fmt.Sprintf("elcli-rollout-%d", time.Now().UnixNano()), cond, tags)
+
+	_, err := r.az.RunJob(j, r.plan.Interval, nil)
+	return err
+}
+
+// health returns the health of the devices targeted by the current step. A device is healthy when its edge agent reports
+// every module of the release running its image, and failed when a module is reported failed or when the hub reports
+// the device failed to apply the configuration.
+func (r *Rollout) health() (RolloutHealth, error) {
+	h := RolloutHealth{}
+
+	twins, err := r.queryTwins(fmt.Sprintf("SELECT * FROM devices%s", where(r.Config.TargetCondition)))
+	if err != nil {
+		return h, err
+	}
+	h.Targeted = len(twins)
+
+	modules, err := releaseModules(r.Config)
+	if err != nil {
+		return h, err
+	}
+
+	for i := 0; i < len(twins); i += agentsBatchSize {
+		ids := []string{}
+		for _, t := range twins[i:min(i+agentsBatchSize, len(twins))] {
+			ids = append(ids, quote(t.DeviceId))
+		}
+
+		agents, err := r.queryTwins(fmt.Sprintf("SELECT * FROM devices.modules WHERE moduleId = '$edgeAgent' AND deviceId IN [%s]", strings.Join(ids, ", ")))
+		if err != nil {
+			return h, err
+		}
+
+		for _, a := range agents {
+			switch agentHealth(a, modules) {
+			case "healthy":
+				h.Healthy++
+			case "failed":
+				h.Failed++
+			}
+		}
+	}
+
+	// the hub counts the devices which failed to apply the configuration, including the ones whose agent is not running
+	c, err := r.az.configurationExists(r.Config.Id)
+	if err != nil {
+		return h, err
+	}
+
+	if c != nil {
+		if failed := systemMetric(c, "reportedFailedCount"); failed > h.Failed {
+			h.Failed = min(failed, h.Targeted-h.Healthy)
+		}
+	}
+
+	h.Pending = h.Targeted - h.Healthy - h.Failed
+	return h, nil
+}
+
+// agentHealth returns the health of a device from the twin of its edge agent: healthy, failed or pending.
+func agentHealth(agent azure.Twin, modules map[string]string) string {
+	if agent.Properties == nil {
+		return "pending"
+	}
+
+	reported, _ := agent.Properties.Reported["modules"].(map[string]interface{})
+
+	health := "healthy"
+	for name, image := range modules {
+		m, _ := reported[name].(map[string]interface{})
+		settings, _ := m["settings"].(map[string]interface{})
+		status, _ := m["runtimeStatus"].(string)
+
+		switch {
+		case failedStatuses[status]:
+			return "failed"
+		case status != "running" || settings["image"] != image:
+			health = "pending"
+		}
+	}
+
+	return health
+}
+
+// releaseModules returns the images of the modules of a configuration, by module name.
+func releaseModules(c *azure.Configuration) (map[string]string, error) {
+	b, err := json.Marshal(c.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	content := struct {
+		ModulesContent struct {
+			EdgeAgent map[string]json.RawMessage `json:"$edgeAgent"`
+		} `json:"modulesContent"`
+	}{}
+	if err := json.Unmarshal(b, &content); err != nil {
+		return nil, err
+	}
+
+	modules := map[string]string{}
+	for k, v := range content.ModulesContent.EdgeAgent {
+		name, found := strings.CutPrefix(k, "properties.desired.modules.")
+		if !found {
+			continue
+		}
+
+		m := struct {
+			Settings struct {
+				Image string `json:"image"`
+			} `json:"settings"`
+		}{}
+		if err := json.Unmarshal(v, &m); err != nil {
+			return nil, err
+		}
+
+		modules[name] = m.Settings.Image
+	}
+
+	return modules, nil
+}
+
+// systemMetric returns a system metric of a configuration, zero if the hub did not compute it.
+func systemMetric(c *azure.Configuration, name string) int {
+	if c.SystemMetrics == nil {
+		return 0
+	}
+
+	return int(c.SystemMetrics.Results[name])
+}
+
+// queryTwins returns the twins matching a query.
+func (r *Rollout) queryTwins(query string) ([]azure.Twin, error) {
+	twins, res, err := r.az.Client.Devices.QueryTwins(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = res.Expect(http.StatusOK); err != nil {
+		return nil, fmt.Errorf("failed to query the devices: %v", res.Response.Header["Iothub-Errorcode"])
+	}
+
+	return twins, nil
+}
+
+// deploymentId returns the id of the deployment the release is rolled out for.
+func (r *Rollout) deploymentId() string {
+	if id := r.Config.Labels[LABEL_ROLLOUT_OF]; id != "" {
+		return id
+	}
+
+	return strings.TrimSuffix(r.Config.Id, "-"+ROLLOUT_SUFFIX)
+}
+
+// releaseId returns the id of the release being rolled out.
+func (r *Rollout) releaseId() string {
+	if id := r.Config.Labels["releaseId"]; id != "" {
+		return id
+	}
+
+	return ROLLOUT_SUFFIX
+}
+
+// and returns the conjunction of the target condition and of a condition, the condition alone if there is no target
+// condition.
+func and(target, cond string) string {
+	if target == "" {
+		return cond
+	}
+
+	return fmt.Sprintf("(%s) AND %s", target, cond)
+}
+
+// rolloutTarget returns the target condition a rollout condition was built from with and, empty if there was none. The
+// parenthesis closing the target is looked for outside of the string literals.
+func rolloutTarget(cond string) string {
+	if !strings.HasPrefix(cond, "(") {
+		return ""
+	}
+
+	depth := 0
+	quoted := false
+	for i := 0; i < len(cond); i++ {
+		switch c := cond[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth--; depth == 0 {
+				if strings.HasPrefix(cond[i+1:], " AND ") {
+					return cond[1:i]
+				}
+				return ""
+			}
+		}
+	}
+
+	return ""
+}
+
+// where returns the WHERE clause of a query for a condition, empty if there is no condition.
+func where(cond string) string {
+	if cond == "" {
+		return ""
+	}
+
+	return " WHERE " + cond
+}
+
+// quote returns a string literal of the query language.
+func quote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
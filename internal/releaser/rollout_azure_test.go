@@ -0,0 +1,371 @@
+package releaser_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/unbrikd/edge-leap/internal/azure"
+	"github.com/unbrikd/edge-leap/internal/condition"
+	"github.com/unbrikd/edge-leap/internal/releaser"
+)
+
+// fakeFleet is an IoT Hub stand-in holding configurations and device twins. The edge agent of every device reports
+// the modules of the configuration of highest priority targeting it, running unless their image is in failing. Twin
+// update jobs complete as soon as they are scheduled.
+type fakeFleet struct {
+	mu      sync.Mutex
+	configs map[string]*azure.Configuration
+	jobs    map[string]*azure.Job
+	tags    map[string]map[string]interface{}
+	failing map[string]bool
+	version int
+}
+
+func newFakeFleet(devices int) *fakeFleet {
+	f := &fakeFleet{configs: map[string]*azure.Configuration{}, jobs: map[string]*azure.Job{}, tags: map[string]map[string]interface{}{}, failing: map[string]bool{}}
+	for i := 0; i < devices; i++ {
+		f.tags[fmt.Sprintf("dev%02d", i)] = map[string]interface{}{"environment": "prod", "ring": []string{"canary", "early", "broad"}[i%3]}
+	}
+
+	return f
+}
+
+func (f *fakeFleet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case parts[0] == "configurations":
+		f.serveConfiguration(w, r, parts[1])
+	case parts[0] == "twins" && r.Method == http.MethodPatch:
+		patch := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&patch)
+		merge(f.tags[parts[1]], patch["tags"].(map[string]interface{}))
+		json.NewEncoder(w).Encode(map[string]interface{}{"deviceId": parts[1], "tags": f.tags[parts[1]]})
+	case parts[0] == "jobs" && r.Method == http.MethodPut:
+		j := new(azure.Job)
+		json.NewDecoder(r.Body).Decode(j)
+		for _, twin := range f.query("SELECT * FROM devices WHERE " + j.QueryCondition) {
+			merge(f.tags[twin["deviceId"].(string)], j.UpdateTwin.Tags.(map[string]interface{}))
+		}
+		j.Status = azure.JOB_STATUS_COMPLETED
+		f.jobs[j.JobId] = j
+		json.NewEncoder(w).Encode(j)
+	case parts[0] == "jobs":
+		json.NewEncoder(w).Encode(f.jobs[parts[2]])
+	case parts[0] == "devices" && parts[1] == "query":
+		q := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&q)
+		json.NewEncoder(w).Encode(f.query(q["query"]))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeFleet) serveConfiguration(w http.ResponseWriter, r *http.Request, id string) {
+	current, exists := f.configs[id]
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	case http.MethodPut:
+		if m := r.Header.Get("If-Match"); m != "" && (!exists || m != fmt.Sprintf(`"%s"`, current.ETag)) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		current = new(azure.Configuration)
+		json.NewDecoder(r.Body).Decode(current)
+		f.version++
+		current.ETag = fmt.Sprint(f.version)
+		f.configs[id] = current
+	case http.MethodDelete:
+		delete(f.configs, id)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	json.NewEncoder(w).Encode(current)
+}
+
+// query answers the device and edge agent twins queries, evaluating their condition.
+func (f *fakeFleet) query(q string) []map[string]interface{} {
+	from, where, _ := strings.Cut(strings.TrimPrefix(q, "SELECT * FROM "), " WHERE ")
+	c, err := condition.Parse(where)
+	if err != nil && where != "" {
+		panic(err)
+	}
+
+	twins := []map[string]interface{}{}
+	for _, id := range sortedKeys(f.tags) {
+		twin := f.twin(id)
+		if from == "devices.modules" {
+			twin = map[string]interface{}{"deviceId": id, "moduleId": "$edgeAgent", "properties": map[string]interface{}{
+				"reported": map[string]interface{}{"modules": f.agentModules(twin)},
+			}}
+		}
+
+		if c == nil || c.Match(twin) {
+			twins = append(twins, twin)
+		}
+	}
+
+	return twins
+}
+
+func (f *fakeFleet) twin(id string) map[string]interface{} {
+	b, _ := json.Marshal(map[string]interface{}{"deviceId": id, "tags": f.tags[id]})
+	twin := map[string]interface{}{}
+	json.Unmarshal(b, &twin)
+	return twin
+}
+
+// agentModules returns the modules reported by the edge agent of a device.
+func (f *fakeFleet) agentModules(twin map[string]interface{}) map[string]interface{} {
+	var applied *azure.Configuration
+	for _, id := range sortedKeys(f.configs) {
+		c := f.configs[id]
+		if cond, err := condition.Parse(c.TargetCondition); err == nil && cond.Match(twin) && (applied == nil || c.Priority > applied.Priority) {
+			applied = c
+		}
+	}
+
+	modules := map[string]interface{}{}
+	if applied == nil {
+		return modules
+	}
+
+	agent := applied.Content["modulesContent"].(map[string]interface{})["$edgeAgent"].(map[string]interface{})
+	for k, v := range agent {
+		image := v.(map[string]interface{})["settings"].(map[string]interface{})["image"].(string)
+		status := "running"
+		if f.failing[image] {
+			status = "backoff"
+		}
+
+		modules[strings.TrimPrefix(k, "properties.desired.modules.")] = map[string]interface{}{
+			"runtimeStatus": status,
+			"settings":      map[string]interface{}{"image": image},
+		}
+	}
+
+	return modules
+}
+
+// image returns the image of the module deployed by a configuration.
+func (f *fakeFleet) image(id string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.configs[id]
+	if !ok {
+		return ""
+	}
+
+	return c.Content["modulesContent"].(map[string]interface{})["$edgeAgent"].(map[string]interface{})["properties.desired.modules.myModule"].(map[string]interface{})["settings"].(map[string]interface{})["image"].(string)
+}
+
+// tagged returns the devices tagged by the rollout of the deployment.
+func (f *fakeFleet) tagged() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	devices := []string{}
+	for _, id := range sortedKeys(f.tags) {
+		if (&azure.Twin{Tags: f.twin(id)["tags"]}).Tag(azure.ROLLOUT_TAG+"."+azure.RolloutKey("my-module")) != nil {
+			devices = append(devices, id)
+		}
+	}
+
+	return devices
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func release(image string) *azure.Configuration {
+	c := &azure.Configuration{Id: "my-module", Priority: 10, TargetCondition: "tags.environment='prod'", Labels: map[string]string{"releaseId": image}}
+	c.SetContent("myModule", image, "", 0, nil)
+	return c
+}
+
+func plan(steps ...releaser.RolloutStep) releaser.RolloutPlan {
+	return releaser.RolloutPlan{
+		TargetCondition: "tags.environment='prod'",
+		RingTag:         "ring",
+		Steps:           steps,
+		MinHealthy:      100,
+		Timeout:         50 * time.Millisecond,
+		Interval:        time.Millisecond,
+	}
+}
+
+func TestRollout(t *testing.T) {
+	f := newFakeFleet(10)
+	r := newTestReleaser(t, f)
+	if err := r.ReleaseModule(release("app:1")); err != nil {
+		t.Fatal(err)
+	}
+
+	rollout, err := r.StartRollout(release("app:2"), plan(releaser.RolloutStep{Percent: 30}, releaser.RolloutStep{Percent: 50}, releaser.RolloutStep{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	targeted := []int{}
+	rollout.Progress = func(step int, h releaser.RolloutHealth) {
+		targeted = append(targeted, h.Targeted)
+		if h.Healthy != h.Targeted {
+			t.Errorf("expected every device of step %d to be healthy, got %s", step, h)
+		}
+
+		// the devices selected by a step stay selected by the next ones
+		if step == 0 {
+			if tagged := f.tagged(); len(tagged) != 3 {
+				t.Errorf("expected 3 devices to be tagged, got %v", tagged)
+			}
+		}
+	}
+
+	if err := rollout.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []int{3, 5, 10}; fmt.Sprint(targeted) != fmt.Sprint(expected) {
+		t.Errorf("expected the steps to target %v devices, got %v", expected, targeted)
+	}
+
+	if image := f.image("my-module"); image != "app:2" {
+		t.Errorf("expected the release to be promoted, got %s", image)
+	}
+
+	if f.image(releaser.RolloutId("my-module")) != "" {
+		t.Error("expected the rollout configuration to be removed")
+	}
+
+	if tagged := f.tagged(); len(tagged) != 0 {
+		t.Errorf("expected the rollout tags to be removed, got %v", tagged)
+	}
+}
+
+func TestRolloutWaitBeyondTimeout(t *testing.T) {
+	f := newFakeFleet(4)
+	r := newTestReleaser(t, f)
+
+	// the timeout only runs while the step is unhealthy, a healthy step waits as long as it must
+	rollout, err := r.StartRollout(release("app:2"), plan(releaser.RolloutStep{Percent: 50, Wait: 120 * time.Millisecond}, releaser.RolloutStep{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rollout.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if image := f.image("my-module"); image != "app:2" {
+		t.Errorf("expected the release to be promoted, got %s", image)
+	}
+}
+
+func TestRolloutRollback(t *testing.T) {
+	f := newFakeFleet(6)
+	f.failing["app:2"] = true
+	r := newTestReleaser(t, f)
+	if err := r.ReleaseModule(release("app:1")); err != nil {
+		t.Fatal(err)
+	}
+
+	rollout, err := r.StartRollout(release("app:2"), plan(releaser.RolloutStep{Ring: "canary"}, releaser.RolloutStep{Ring: "early"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cond := rollout.Config.TargetCondition; cond != "(tags.environment='prod') AND tags.ring IN ['canary']" {
+		t.Errorf("unexpected target condition %s", cond)
+	}
+
+	var failed *releaser.RolloutFailedError
+	if err := rollout.Run(); !errors.As(err, &failed) {
+		t.Fatalf("expected the rollout to fail, got %v", err)
+	}
+
+	if failed.Step != "canary" || failed.Health.Failed != 2 {
+		t.Errorf("expected the 2 canary devices to fail, got %v", failed)
+	}
+
+	if image := f.image("my-module"); image != "app:1" {
+		t.Errorf("expected the deployment to be left untouched, got %s", image)
+	}
+
+	if f.image(releaser.RolloutId("my-module")) != "" {
+		t.Error("expected the rollout to be rolled back")
+	}
+}
+
+func TestRolloutNoDevice(t *testing.T) {
+	f := newFakeFleet(3)
+	r := newTestReleaser(t, f)
+
+	// a step targeting no device fails once the timeout is over, rather than passing as healthy
+	rollout, err := r.StartRollout(release("app:2"), plan(releaser.RolloutStep{Ring: "missing"}, releaser.RolloutStep{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failed *releaser.RolloutFailedError
+	if err := rollout.Run(); !errors.As(err, &failed) || failed.Health.Targeted != 0 {
+		t.Fatalf("expected the rollout to fail without devices, got %v", err)
+	}
+
+	if f.image("my-module") != "" {
+		t.Error("expected the release not to be promoted")
+	}
+}
+
+func TestResumeRollout(t *testing.T) {
+	f := newFakeFleet(6)
+	r := newTestReleaser(t, f)
+
+	p := plan(releaser.RolloutStep{Ring: "canary"}, releaser.RolloutStep{Ring: "early"}, releaser.RolloutStep{Ring: "broad"})
+	if _, err := r.StartRollout(release("app:2"), p); err != nil {
+		t.Fatal(err)
+	}
+
+	var inProgress *releaser.RolloutInProgressError
+	if _, err := r.StartRollout(release("app:3"), p); !errors.As(err, &inProgress) || inProgress.ReleaseId != "app:2" {
+		t.Fatalf("expected the rollout of app:2 to be in progress, got %v", err)
+	}
+
+	rollout, err := r.ResumeRollout("my-module", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rollout.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if image := f.image("my-module"); image != "app:2" {
+		t.Errorf("expected the release to be promoted, got %s", image)
+	}
+
+	if _, err := r.ResumeRollout("my-module", p); err == nil {
+		t.Error("expected an error when no release is being rolled out")
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"strings"
@@ -15,17 +16,120 @@ func GetEnv(key, fallback string) string {
 	return fallback
 }
 
-// StringArraySplitToMap converts an array of strings into a map of strings using a separator.
+// StringArraySplitToMap converts an array of strings into a map of strings using a separator. Only the first separator
+// splits the key from the value, so values can hold the separator (e.g. CONN=HostName=x;Key=y==). Values are kept as
+// is, quotes included, the quotes of the dotenv files being removed by ReadDotEnv.
 func StringArraySplitToMap(arr []string, sep string) (map[string]string, error) {
 	m := make(map[string]string)
 	for _, v := range arr {
-		p := strings.Split(v, sep)
-		if len(p) != 2 {
+		k, val, found := strings.Cut(v, sep)
+		if !found || strings.TrimSpace(k) == "" {
 			return nil, fmt.Errorf("invalid key-value pair: %s", v)
 		}
 
-		m[p[0]] = p[1]
+		m[strings.TrimSpace(k)] = val
 	}
 
 	return m, nil
 }
+
+// Unquote removes the single or double quotes enclosing a value. Escape sequences (\n, \t, \" and \\) are interpreted
+// in double quoted values, single quoted values are kept as is. Values not enclosed in quotes are returned untouched.
+func Unquote(v string) string {
+	if len(v) < 2 || v[0] != v[len(v)-1] || (v[0] != '"' && v[0] != '\'') {
+		return v
+	}
+
+	if v[0] == '\'' {
+		return v[1 : len(v)-1]
+	}
+
+	return strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(v[1 : len(v)-1])
+}
+
+// ReadDotEnv reads a dotenv file and returns its variables as KEY=VALUE pairs, in the file order. Empty lines and
+// comments are ignored, lines can start with 'export ' and values can be quoted. Unquoted values end at the first ' #',
+// quoted values at their closing quote, a comment being allowed after it.
+func ReadDotEnv(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pairs := []string{}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		k, v, found := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !found || k == "" {
+			return nil, fmt.Errorf("%s:%d: invalid line, expected KEY=VALUE", path, n)
+		}
+
+		v = strings.TrimSpace(v)
+		if strings.HasPrefix(v, `"`) || strings.HasPrefix(v, "'") {
+			i := closingQuote(v)
+			if i < 0 {
+				return nil, fmt.Errorf("%s:%d: invalid line, missing closing quote", path, n)
+			}
+
+			if rest := strings.TrimSpace(v[i+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return nil, fmt.Errorf("%s:%d: invalid line, unexpected text after the quoted value", path, n)
+			}
+			v = v[:i+1]
+		} else if i := strings.Index(v, " #"); i >= 0 {
+			v = strings.TrimSpace(v[:i])
+		}
+
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, Unquote(v)))
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return pairs, nil
+}
+
+// closingQuote returns the index of the quote closing a value starting with a quote, -1 if there is none. Quotes escaped
+// with a backslash do not close double quoted values.
+func closingQuote(v string) int {
+	for i := 1; i < len(v); i++ {
+		switch {
+		case v[0] == '"' && v[i] == '\\':
+			i++
+		case v[i] == v[0]:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// MergeKeyValuePairs merges lists of KEY=VALUE pairs, the pairs of the later lists override the pairs with the same key
+// of the former ones. Keys keep the position of their first appearance.
+func MergeKeyValuePairs(sep string, lists ...[]string) []string {
+	merged := []string{}
+	index := map[string]int{}
+
+	for _, l := range lists {
+		for _, p := range l {
+			k, _, _ := strings.Cut(p, sep)
+			if i, ok := index[k]; ok {
+				merged[i] = p
+				continue
+			}
+
+			index[k] = len(merged)
+			merged = append(merged, p)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,112 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/unbrikd/edge-leap/internal/utils"
+)
+
+func TestStringArraySplitToMap(t *testing.T) {
+	m, err := utils.StringArraySplitToMap([]string{
+		"CONN=HostName=x;SharedAccessKey=abc==",
+		`QUOTED="hello world"`,
+		"SINGLE='a \"b\"'",
+		"EMPTY=",
+	}, "=")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"CONN":   "HostName=x;SharedAccessKey=abc==",
+		"QUOTED": `"hello world"`,
+		"SINGLE": `'a "b"'`,
+		"EMPTY":  "",
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+
+	for _, invalid := range []string{"NO_SEPARATOR", "=value"} {
+		if _, err := utils.StringArraySplitToMap([]string{invalid}, "="); err == nil {
+			t.Errorf("expected an error for '%s'", invalid)
+		}
+	}
+}
+
+func TestReadDotEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	content := `# comment
+LOG_LEVEL=debug # trailing comment
+
+export CONN=HostName=x;SharedAccessKey=abc==
+MESSAGE="multi\nline # not a comment"
+RAW='$NOT_EXPANDED'
+QUOTED="value" # trailing comment
+INNER='"hi"'
+ESCAPED="say \"hi\" # here" # trailing comment
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	pairs, err := utils.ReadDotEnv(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"LOG_LEVEL=debug",
+		"CONN=HostName=x;SharedAccessKey=abc==",
+		"MESSAGE=multi\nline # not a comment",
+		"RAW=$NOT_EXPANDED",
+		"QUOTED=value",
+		`INNER="hi"`,
+		`ESCAPED=say "hi" # here`,
+	}
+	if !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("expected %q, got %q", expected, pairs)
+	}
+
+	if err := os.WriteFile(path, []byte("LOG_LEVEL=debug\nINVALID\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := utils.ReadDotEnv(path); err == nil || err.Error() != path+":2: invalid line, expected KEY=VALUE" {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("MESSAGE=\"unterminated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := utils.ReadDotEnv(path); err == nil || err.Error() != path+":1: invalid line, missing closing quote" {
+		t.Errorf("expected a missing quote error on line 1, got %v", err)
+	}
+
+	// the values read from a dotenv file are unquoted once, the quotes they hold reach the module
+	env, err := utils.StringArraySplitToMap(pairs, "=")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if env["INNER"] != `"hi"` {
+		t.Errorf("expected the inner quotes to be kept, got %s", env["INNER"])
+	}
+}
+
+func TestMergeKeyValuePairs(t *testing.T) {
+	merged := utils.MergeKeyValuePairs("=",
+		[]string{"A=1", "B=2"},
+		[]string{"C=3", "A=file"},
+		[]string{"B=flag"},
+	)
+
+	expected := []string{"A=file", "B=flag", "C=3"}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v, got %v", expected, merged)
+	}
+}